@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+const (
+	ConsulPassing  = "passing"
+	ConsulWarning  = "warning"
+	ConsulCritical = "critical"
+)
+
+// A minimal client for the check endpoints of the Consul agent API
+type ConsulClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func NewConsulClient(addr string, token string, timeout time.Duration) *ConsulClient {
+	return &ConsulClient{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// The body of /v1/agent/check/register for a TTL check
+type ConsulCheck struct {
+	ID                             string `json:"ID"`
+	Name                           string `json:"Name"`
+	Notes                          string `json:"Notes,omitempty"`
+	ServiceID                      string `json:"ServiceID,omitempty"`
+	TTL                            string `json:"TTL"`
+	Status                         string `json:"Status,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+func (c *ConsulClient) put(path string, body interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("consul returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (c *ConsulClient) RegisterCheck(check ConsulCheck) error {
+	return c.put("/v1/agent/check/register", check)
+}
+
+func (c *ConsulClient) UpdateCheck(id string, status string, output string) error {
+	return c.put("/v1/agent/check/update/"+url.PathEscape(id), map[string]string{
+		"Status": status,
+		"Output": output,
+	})
+}
+
+func (c *ConsulClient) DeregisterCheck(id string) error {
+	return c.put("/v1/agent/check/deregister/"+url.PathEscape(id), nil)
+}
+
+// Maps the verdict onto a consul check status, failing warn checks turn a passing check into a warning
+func ConsulStatus(s *solanahc.HealthState) (status string, output string) {
+	verdict, reason := s.GetVerdict()
+	output = solanahc.FormatStatus(verdict, reason)
+
+	switch verdict {
+	case solanahc.StatusUp:
+		if len(s.Warnings()) > 0 {
+			return ConsulWarning, output
+		}
+		return ConsulPassing, output
+	case solanahc.StatusDrain:
+		return ConsulWarning, output
+	default:
+		return ConsulCritical, output
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	"github.com/linuskendall/solana-rpc-health-check/health-check/simulation"
+)
+
+// Stands in for the check endpoints of the Consul agent API
+type fakeAgent struct {
+	*httptest.Server
+	token string
+
+	mu       sync.Mutex
+	checks   map[string]ConsulCheck
+	statuses map[string]string
+	outputs  map[string]string
+}
+
+func newFakeAgent(t *testing.T, token string) *fakeAgent {
+	a := &fakeAgent{token: token}
+	a.reset()
+	a.Server = httptest.NewServer(http.HandlerFunc(a.serveHTTP))
+	t.Cleanup(a.Close)
+	return a
+}
+
+// Forgets every check like an agent restarted without persistence
+func (a *fakeAgent) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.checks = map[string]ConsulCheck{}
+	a.statuses = map[string]string{}
+	a.outputs = map[string]string{}
+}
+
+func (a *fakeAgent) status(id string) (status string, output string, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok = a.checks[id]; !ok {
+		return
+	}
+	return a.statuses[id], a.outputs[id], true
+}
+
+func (a *fakeAgent) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("X-Consul-Token") != a.token {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/agent/check/register":
+		var check ConsulCheck
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil || check.ID == "" || check.TTL == "" {
+			http.Error(w, "invalid check", http.StatusBadRequest)
+			return
+		}
+		a.checks[check.ID] = check
+		a.statuses[check.ID] = check.Status
+
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/")
+		if _, ok := a.checks[id]; !ok {
+			http.Error(w, "Unknown check ID \""+id+"\"", http.StatusNotFound)
+			return
+		}
+		var update map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+		a.statuses[id] = update["Status"]
+		a.outputs[id] = update["Output"]
+
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/deregister/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/deregister/")
+		if _, ok := a.checks[id]; !ok {
+			http.Error(w, "Unknown check ID \""+id+"\"", http.StatusNotFound)
+			return
+		}
+		delete(a.checks, id)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestConsulChecks(t *testing.T) {
+	cluster := simulation.NewCluster()
+	t.Cleanup(cluster.Close)
+	healthy, behind := cluster.Healthy, cluster.Behind
+
+	targets := []consulTarget{}
+	states := []*solanahc.HealthState{}
+	for _, spec := range []string{"rpc-1=" + healthy.URL, behind.URL} {
+		serviceID, rpcUri := parseBackend(spec)
+		state := cluster.HealthState(rpcUri)
+		targets = append(targets, consulTarget{state: state, check: newCheck(serviceID, rpcUri)})
+		states = append(states, state)
+	}
+	if targets[0].check.ServiceID != "rpc-1" || targets[0].check.ID != *checkPrefix+"rpc-1" {
+		t.Fatalf("unexpected check for a service: %+v", targets[0].check)
+	}
+	if targets[1].check.ServiceID != "" || targets[1].check.ID != *checkPrefix+strings.TrimPrefix(behind.URL, "http://") {
+		t.Fatalf("unexpected check for a host: %+v", targets[1].check)
+	}
+
+	agent := newFakeAgent(t, "secret")
+	consul := NewConsulClient(agent.URL+"/", "secret", time.Second)
+	for _, target := range targets {
+		if err := consul.RegisterCheck(target.check); err != nil {
+			t.Fatal(err)
+		}
+		if status, _, _ := agent.status(target.check.ID); status != ConsulCritical {
+			t.Fatalf("check %s starts %q, want %q", target.check.ID, status, ConsulCritical)
+		}
+	}
+
+	monitor := cluster.Monitor(states)
+	monitor.Check()
+
+	checkStatuses := func() {
+		t.Helper()
+		for i, want := range []string{ConsulPassing, ConsulCritical} {
+			id := targets[i].check.ID
+			status, output, ok := agent.status(id)
+			if !ok {
+				t.Fatalf("check %s isn't registered", id)
+			}
+			if status != want {
+				t.Errorf("check %s is %q, want %q", id, status, want)
+			}
+			verdict, reason := targets[i].state.GetVerdict()
+			if output != solanahc.FormatStatus(verdict, reason) {
+				t.Errorf("check %s output is %q", id, output)
+			}
+		}
+	}
+	update(consul, targets)
+	checkStatuses()
+
+	// Checks are registered again when the agent lost them
+	agent.reset()
+	update(consul, targets)
+	checkStatuses()
+
+	for _, target := range targets {
+		if err := consul.DeregisterCheck(target.check.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, ok := agent.status(target.check.ID); ok {
+			t.Errorf("check %s is still registered", target.check.ID)
+		}
+	}
+}
+
+func TestConsulClientToken(t *testing.T) {
+	agent := newFakeAgent(t, "secret")
+	consul := NewConsulClient(agent.URL, "wrong", time.Second)
+
+	err := consul.RegisterCheck(ConsulCheck{ID: "check", Name: "check", TTL: "30s"})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected a 403 error, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+const (
+	HEALTH_UPDATE_INTERVAL time.Duration = 10 * time.Second
+)
+
+var (
+	consulAddr      = flag.String("consul-addr", "http://127.0.0.1:8500", "Address of the Consul agent API")
+	consulTokenFile = flag.String("consul-token-file", "", "File containing the Consul ACL token")
+	consulTimeout   = flag.Duration("consul-timeout", 5*time.Second, "Timeout for calls to the Consul agent")
+	backends        = flag.String("backends", "http://localhost:8899", "Comma separated list of Solana RPC URIs, each optionally prefixed with the Consul service id as service=uri")
+	checkPrefix     = flag.String("check-prefix", "solana-rpc-health:", "Prefix of the Consul check ids")
+	checkTTL        = flag.Duration("ttl", 3*HEALTH_UPDATE_INTERVAL, "TTL of the Consul checks, they turn critical if not updated within it")
+	deregisterAfter = flag.Duration("deregister-critical-after", 0, "Have Consul deregister the service once its check has been critical this long (disabled if 0)")
+	compareBackends = flag.Bool("compare-backends", false, "Also compare every backend against the other backends")
+	checkFlags      = solanahc.RegisterCheckFlags(flag.CommandLine)
+)
+
+// A monitored node and the consul check reporting its health
+type consulTarget struct {
+	state *solanahc.HealthState
+	check ConsulCheck
+}
+
+// Parses service=uri, the check id is derived from the service id or else from the host
+func parseBackend(spec string) (serviceID string, rpcUri string) {
+	rpcUri = spec
+	if i := strings.Index(spec, "="); i > 0 && !strings.Contains(spec[:i], "://") {
+		serviceID, rpcUri = spec[:i], spec[i+1:]
+	}
+	return
+}
+
+func newCheck(serviceID string, rpcUri string) ConsulCheck {
+	id := serviceID
+	if id == "" {
+		id = rpcUri
+		if u, err := url.Parse(rpcUri); err == nil && u.Host != "" {
+			id = u.Host
+		}
+	}
+
+	check := ConsulCheck{
+		ID:        *checkPrefix + id,
+		Name:      "Solana RPC health " + rpcUri,
+		Notes:     "Updated by consul-health-check from the health verdict of " + rpcUri,
+		ServiceID: serviceID,
+		TTL:       checkTTL.String(),
+		Status:    ConsulCritical,
+	}
+	if *deregisterAfter > 0 {
+		check.DeregisterCriticalServiceAfter = deregisterAfter.String()
+	}
+	return check
+}
+
+func update(consul *ConsulClient, targets []consulTarget) {
+	for _, t := range targets {
+		status, output := ConsulStatus(t.state)
+		log.Println("updating check ", t.check.ID, " status=", status, " output=", output)
+
+		err := consul.UpdateCheck(t.check.ID, status, output)
+		if err != nil {
+			// The agent loses its checks when it restarts without persistence, so register again
+			log.Println("error updating check ", t.check.ID, " ", err, ", registering it again")
+			if err = consul.RegisterCheck(t.check); err == nil {
+				err = consul.UpdateCheck(t.check.ID, status, output)
+			}
+		}
+		if err != nil {
+			log.Println("error updating check ", t.check.ID, " ", err)
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	var token string
+	if *consulTokenFile != "" {
+		data, err := ioutil.ReadFile(*consulTokenFile)
+		if err != nil {
+			log.Fatal("couldn't read consul token ", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	consul := NewConsulClient(*consulAddr, token, *consulTimeout)
+
+	levels, fallback, err := checkFlags.Levels()
+	if err != nil {
+		log.Fatal("invalid -check-levels: ", err)
+	}
+
+	config := checkFlags.Config()
+
+	targets := []consulTarget{}
+	states := []*solanahc.HealthState{}
+	for _, spec := range solanahc.SplitList(*backends) {
+		serviceID, rpcUri := parseBackend(spec)
+		state := solanahc.NewHealthState(rpcUri, config, levels, fallback)
+		targets = append(targets, consulTarget{state: state, check: newCheck(serviceID, rpcUri)})
+		states = append(states, state)
+	}
+	if len(targets) == 0 {
+		log.Fatal("need at least one backend")
+	}
+	servers := checkFlags.References()
+
+	log.Println("Updating consul checks on ", *consulAddr, "backends", *backends, "reference servers", servers)
+
+	for _, t := range targets {
+		if err := consul.RegisterCheck(t.check); err != nil {
+			log.Fatal("couldn't register check ", t.check.ID, ": ", err)
+		}
+		log.Println("registered check ", t.check.ID, " service=", t.check.ServiceID)
+	}
+
+	monitor := solanahc.NewMonitor(states, servers)
+	monitor.CompareTargets = *compareBackends
+	monitor.OnEvaluated(func() {
+		update(consul, targets)
+	})
+	go monitor.Run(HEALTH_UPDATE_INTERVAL)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Println("received ", sig, ", deregistering checks")
+
+	for _, t := range targets {
+		if err := consul.DeregisterCheck(t.check.ID); err != nil {
+			log.Println("error deregistering check ", t.check.ID, " ", err)
+		}
+	}
+	log.Println("stopped")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// A row of the output, the node together with the highest slot of all loaded nodes
+type Row struct {
+	Id        int
+	Time      time.Time
+	State     solanahc.NodeSnapshot
+	Reference solanahc.Reference
+	// The row of the same node in the previous iteration of the watch mode
+	Previous *Row
+}
+
+func (r Row) lag() int64 {
+	return int64(r.Reference.Slot) - int64(r.State.CurrentSlot)
+}
+
+// Returns the change of a value since the previous iteration, nil without one
+func (r Row) delta(value func(r Row) int64) interface{} {
+	if r.Previous == nil {
+		return nil
+	}
+	return value(r) - value(*r.Previous)
+}
+
+type Column struct {
+	Name        string
+	Description string
+	// Set for columns which need the version, identity and genesis hash
+	Meta bool
+	// Set for columns which need the finalized slot
+	Finalized bool
+	// Set for columns about load failures, the nodes that failed to load are only output with them
+	Errors bool
+	Value  func(row Row) interface{}
+}
+
+var Columns = []Column{
+	{Name: "time", Description: "time the states were loaded", Value: func(r Row) interface{} { return r.Time.Format(time.RFC3339) }},
+	{Name: "id", Description: "position of the node on the command line", Value: func(r Row) interface{} { return r.Id }},
+	{Name: "rpcNode", Description: "rpc uri", Value: func(r Row) interface{} { return r.State.RpcNode }},
+	{Name: "hasErrors", Description: "whether loading the node failed", Errors: true, Value: func(r Row) interface{} { return r.State.HasErrors }},
+	{Name: "errors", Description: "errors while loading the node", Errors: true, Value: func(r Row) interface{} { return strings.Join(r.State.Errors, "; ") }},
+	{Name: "minSlot", Description: "minimum ledger slot", Value: func(r Row) interface{} { return r.State.MinimumSlot }},
+	{Name: "curSlot", Description: "current (confirmed) slot", Value: func(r Row) interface{} { return r.State.CurrentSlot }},
+	{Name: "finalizedSlot", Description: "finalized slot, the current slot before the switch to confirmed", Finalized: true, Value: func(r Row) interface{} { return r.State.FinalizedSlot }},
+	{Name: "processedSlot", Description: "processed slot", Value: func(r Row) interface{} { return r.State.ProcessedSlot }},
+	{Name: "maxRetransmitSlot", Description: "max retransmit slot", Value: func(r Row) interface{} { return r.State.MaxRetransmitSlot }},
+	{Name: "slotsStored", Description: "curSlot - minSlot", Value: func(r Row) interface{} { return uint64(r.State.CurrentSlot - r.State.MinimumSlot) }},
+	{Name: "lag", Description: "slots behind the highest curSlot of all loaded nodes", Value: func(r Row) interface{} { return r.lag() }},
+	{Name: "retransmitLag", Description: "maxRetransmitSlot - curSlot", Value: func(r Row) interface{} { return int64(r.State.MaxRetransmitSlot) - int64(r.State.CurrentSlot) }},
+	{Name: "prevEpochBlocks", Description: "blocks stored in the previous epoch", Value: func(r Row) interface{} { return r.State.PrevEpochBlocks }},
+	{Name: "curEpochBlocks", Description: "blocks stored in the current epoch", Value: func(r Row) interface{} { return r.State.CurEpochBlocks }},
+	{Name: "slotsAdvanced", Description: "watch: curSlot advance since the previous iteration", Value: func(r Row) interface{} {
+		return r.delta(func(r Row) int64 { return int64(r.State.CurrentSlot) })
+	}},
+	{Name: "slotsPerSec", Description: "watch: slots per second since the previous iteration", Value: func(r Row) interface{} {
+		if r.Previous == nil || !r.Time.After(r.Previous.Time) {
+			return nil
+		}
+		advanced := int64(r.State.CurrentSlot) - int64(r.Previous.State.CurrentSlot)
+		return math.Round(float64(advanced)/r.Time.Sub(r.Previous.Time).Seconds()*100) / 100
+	}},
+	{Name: "lagTrend", Description: "watch: change of lag since the previous iteration, positive when falling behind", Value: func(r Row) interface{} {
+		return r.delta(Row.lag)
+	}},
+	{Name: "minSlotAdvanced", Description: "watch: minSlot advance since the previous iteration", Value: func(r Row) interface{} {
+		return r.delta(func(r Row) int64 { return int64(r.State.MinimumSlot) })
+	}},
+	{Name: "latency", Description: "duration of the first rpc call in milliseconds", Value: func(r Row) interface{} { return r.State.Latency.Milliseconds() }},
+	{Name: "epoch", Description: "current epoch", Value: func(r Row) interface{} { return r.State.Epoch.Epoch }},
+	{Name: "slotIndex", Description: "slot index in the current epoch", Value: func(r Row) interface{} { return r.State.Epoch.SlotIndex }},
+	{Name: "slotsInEpoch", Description: "slots in the current epoch", Value: func(r Row) interface{} { return r.State.Epoch.SlotsInEpoch }},
+	{Name: "blockHeight", Description: "block height", Value: func(r Row) interface{} { return r.State.Epoch.BlockHeight }},
+	{Name: "transactionCount", Description: "transaction count", Value: func(r Row) interface{} { return r.State.Epoch.TransactionCount }},
+	{Name: "version", Description: "solana-core version", Meta: true, Value: func(r Row) interface{} { return r.State.Version.CoreVersion }},
+	{Name: "featureSet", Description: "feature set", Meta: true, Value: func(r Row) interface{} { return r.State.Version.FeatureSet }},
+	{Name: "identity", Description: "node identity", Meta: true, Value: func(r Row) interface{} { return r.State.Identity }},
+	{Name: "genesis", Description: "genesis hash", Meta: true, Value: func(r Row) interface{} { return r.State.GenesisHash }},
+}
+
+const DefaultColumns = "id,rpcNode,minSlot,curSlot,maxRetransmitSlot,slotsStored,prevEpochBlocks,curEpochBlocks"
+
+// Used by the watch mode unless -columns is given
+const DefaultWatchColumns = "time,rpcNode,curSlot,slotsAdvanced,slotsPerSec,lag,lagTrend,minSlot,minSlotAdvanced"
+
+// Whether the nodes that failed to load are output, only if a column shows the failure
+func WithFailed(columns []Column) (failed bool) {
+	for _, c := range columns {
+		failed = failed || c.Errors
+	}
+	return
+}
+
+// Looks up a comma separated list of column names
+func ParseColumns(list string) (columns []Column, err error) {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, c := range Columns {
+			if c.Name == name {
+				columns = append(columns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	if len(columns) == 0 {
+		err = fmt.Errorf("no columns selected")
+	}
+	return
+}
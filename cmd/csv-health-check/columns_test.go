@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		list  string
+		names []string
+		ok    bool
+	}{
+		{list: DefaultColumns, names: []string{"id", "rpcNode", "minSlot", "curSlot", "maxRetransmitSlot", "slotsStored", "prevEpochBlocks", "curEpochBlocks"}, ok: true},
+		{list: " lag , rpcNode,", names: []string{"lag", "rpcNode"}, ok: true},
+		{list: "lag,unknown", ok: false},
+		{list: " , ", ok: false},
+		{list: "", ok: false},
+	}
+	for _, test := range tests {
+		columns, err := ParseColumns(test.list)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got error %v, want ok %v", test.list, err, test.ok)
+			continue
+		}
+		names := header(columns)
+		if len(names) != len(test.names) {
+			t.Errorf("%q: got columns %v, want %v", test.list, names, test.names)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.names[i] {
+				t.Errorf("%q: got columns %v, want %v", test.list, names, test.names)
+				break
+			}
+		}
+	}
+
+	for _, list := range []string{DefaultColumns, DefaultWatchColumns} {
+		if _, err := ParseColumns(list); err != nil {
+			t.Errorf("default columns %q: %v", list, err)
+		}
+	}
+}
+
+func TestWithFailed(t *testing.T) {
+	without, _ := ParseColumns("rpcNode,curSlot")
+	with, _ := ParseColumns("rpcNode,errors")
+	if WithFailed(without) || !WithFailed(with) {
+		t.Errorf("the failed nodes are output without an error column or not output with one")
+	}
+}
+
+func TestColumnValues(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	previous := &Row{
+		Time:      now.Add(-10 * time.Second),
+		State:     solanahc.NodeSnapshot{MinimumSlot: 100, CurrentSlot: 900},
+		Reference: solanahc.Reference{Slot: 950},
+	}
+	row := Row{
+		Id:        2,
+		Time:      now,
+		State:     solanahc.NodeSnapshot{RpcNode: "http://node:8899", MinimumSlot: 150, CurrentSlot: 915, FinalizedSlot: 883, MaxRetransmitSlot: 920, Errors: []string{"a", "b"}},
+		Reference: solanahc.Reference{Slot: 1000},
+		Previous:  previous,
+	}
+
+	want := map[string]interface{}{
+		"time":            "2021-03-01T12:00:00Z",
+		"id":              2,
+		"errors":          "a; b",
+		"finalizedSlot":   solanarpc.Slot(883),
+		"slotsStored":     uint64(765),
+		"lag":             int64(85),
+		"retransmitLag":   int64(5),
+		"slotsAdvanced":   int64(15),
+		"slotsPerSec":     1.5,
+		"lagTrend":        int64(35),
+		"minSlotAdvanced": int64(50),
+	}
+	for _, c := range Columns {
+		value, ok := want[c.Name]
+		if !ok {
+			continue
+		}
+		if got := c.Value(row); got != value {
+			t.Errorf("%s: got %v (%T), want %v (%T)", c.Name, got, got, value, value)
+		}
+	}
+
+	// The watch columns are empty in the first iteration
+	row.Previous = nil
+	for _, c := range Columns {
+		switch c.Name {
+		case "slotsAdvanced", "slotsPerSec", "lagTrend", "minSlotAdvanced":
+			if got := c.Value(row); got != nil {
+				t.Errorf("%s: got %v without a previous iteration", c.Name, got)
+			}
+		}
+	}
+}
@@ -1,20 +1,93 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
 	"github.com/linuskendall/solana-rpc-health-check/rpc"
 )
 
+var (
+	columnList = flag.String("columns", DefaultColumns, "Comma separated list of columns, see -list-columns")
+	format     = flag.String("format", "csv", "Output format, one of "+strings.Join(Formats, ", "))
+	list       = flag.Bool("list-columns", false, "List the available columns and exit")
+	loadBlocks = flag.Bool("blocks", true, "Load the blocks stored in the previous and current epoch (expensive)")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] rpcnode1 [rpcnode2 [rpcnode3]]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// Checks the first node against the others, the log is discarded as Nagios only reads the summary
+func runNagios(nodes []string) {
+	log.SetOutput(ioutil.Discard)
+
+	states := solanahc.NewNodeStates(nodes, *loadBlocks, true)
+	states.LoadMeta = len(nodes) > 1
+	states.LoadStates()
+
+	target, references := NagiosNodes(states, nodes[0])
+	result := RunNagios(target, references, len(nodes)-1)
+	fmt.Println(result)
+	os.Exit(result.Code)
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("usage: ", os.Args[0], " rpcnode1 [rpcnode2 [rpcnode3]]")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *list {
+		for _, c := range Columns {
+			fmt.Printf("%-18s %s\n", c.Name, c.Description)
+		}
+		return
+	}
+
+	if flag.NArg() < 1 {
+		usage()
+		if *nagios {
+			os.Exit(NagiosUnknown)
+		}
+		os.Exit(2)
+	}
+
+	if *nagios {
+		runNagios(flag.Args())
+		return
 	}
 
-	states := solanahc.NewNodeStates(os.Args[1:len(os.Args)], true, true)
+	columns, err := ParseColumns(*columnList)
+	if err != nil {
+		log.Fatal("invalid -columns: ", err)
+	}
+	validFormat := false
+	for _, f := range Formats {
+		validFormat = validFormat || f == *format
+	}
+	if !validFormat {
+		log.Fatal("invalid -format ", *format)
+	}
+
+	nodes := flag.Args()
+	states := solanahc.NewNodeStates(nodes, *loadBlocks, true)
+	for _, c := range columns {
+		states.LoadMeta = states.LoadMeta || c.Meta
+		states.LoadFinalizedSlot = states.LoadFinalizedSlot || c.Finalized
+	}
+
+	if *watch > 0 {
+		if err := Watch(states, nodes, columns); err != nil {
+			log.Fatal("error writing output ", err)
+		}
+		return
+	}
 
 	nStates, err := states.LoadStates()
 	if err != nil {
@@ -32,10 +105,42 @@ func main() {
 	log.Println("Epoch ", previousEpoch, " first slot ", epoch_schedule.GetFirstSlotInEpoch(previousEpoch), " last slot ", epoch_schedule.GetLastSlotInEpoch(previousEpoch))
 	log.Println("Epoch ", currentEpoch, " first slot ", epoch_schedule.GetFirstSlotInEpoch(currentEpoch), " last slot ", epoch_schedule.GetLastSlotInEpoch(currentEpoch))
 
-	fmt.Println("id,rpcNode,minSlot,curSlot,maxRetransmitSlot,slotsStored,prevEpochBlocks,curEpochBlocks")
-	for id, state := range states.States {
-		fmt.Println(id, ",", state.RpcNode, ",", state.MinimumSlot, ",", state.MaxRetransmitSlot, ",", state.CurrentSlot, ",", uint64(state.CurrentSlot-state.MinimumSlot), ",", len(state.PrevEpochBlocks), ",", len(state.CurEpochBlocks))
+	rows := BuildRows(states, nodes, time.Now(), nil, WithFailed(columns))
+	if err := WriteRows(os.Stdout, *format, columns, rows); err != nil {
+		log.Fatal("error writing output ", err)
+	}
+}
+
+// Builds a row for every node that could be loaded, and for the failed ones if withFailed is
+// set, in the order they were given. The previous rows, by node, are used for the deltas of the watch mode.
+func BuildRows(states *solanahc.NodeStates, nodes []string, now time.Time, previous map[string]Row, withFailed bool) (rows []Row) {
+	// The states are loaded concurrently, print them in the order they were given
+	snapshots := map[string]solanahc.NodeSnapshot{}
+	all := []solanahc.NodeSnapshot{}
+	for i := range states.States {
+		snapshot := states.States[i].Snapshot()
+		snapshots[snapshot.RpcNode] = snapshot
+		all = append(all, snapshot)
+	}
+	if withFailed {
+		for i := range states.Failed {
+			snapshot := states.Failed[i].Snapshot()
+			snapshots[snapshot.RpcNode] = snapshot
+		}
 	}
 
+	for id, node := range nodes {
+		snapshot, ok := snapshots[node]
+		if !ok {
+			log.Println("couldn't load ", node)
+			continue
+		}
+		row := Row{Id: id, Time: now, State: snapshot, Reference: solanahc.NewReference(snapshot, all)}
+		if p, ok := previous[node]; ok {
+			row.Previous = &p
+			row.Previous.Previous = nil
+		}
+		rows = append(rows, row)
+	}
 	return
 }
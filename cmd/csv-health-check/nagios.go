@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// Nagios plugin exit codes
+const (
+	NagiosOk       = 0
+	NagiosWarning  = 1
+	NagiosCritical = 2
+	NagiosUnknown  = 3
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+var (
+	nagios          = flag.Bool("nagios", false, "Run as a Nagios plugin checking the first node against the others, exits 0/1/2/3 for OK/WARNING/CRITICAL/UNKNOWN")
+	warnSlotDiff    = flag.Int("warn-slot-diff", 50, "Nagios: slots behind the references to warn at")
+	critSlotDiff    = flag.Int("crit-slot-diff", 200, "Nagios: slots behind the references to be critical at")
+	warnBlockDiff   = flag.Int("warn-block-diff", 100, "Nagios: difference in blocks stored in the current epoch to warn at (with -blocks)")
+	critBlockDiff   = flag.Int("crit-block-diff", 300, "Nagios: difference in blocks stored in the current epoch to be critical at (with -blocks)")
+	warnSlotsStored = flag.Int("warn-slots-stored", 0, "Nagios: minimum number of slots stored below which to warn (disabled if 0)")
+	critSlotsStored = flag.Int("crit-slots-stored", 0, "Nagios: minimum number of slots stored below which to be critical (disabled if 0)")
+	warnLatency     = flag.Duration("warn-latency", time.Second, "Nagios: rpc latency to warn at")
+	critLatency     = flag.Duration("crit-latency", 5*time.Second, "Nagios: rpc latency to be critical at")
+)
+
+// The outcome of a plugin run
+type NagiosResult struct {
+	Code     int
+	Summary  string
+	Perfdata []string
+}
+
+func (r NagiosResult) String() string {
+	line := "SOLANA RPC " + nagiosStates[r.Code] + " - " + r.Summary
+	if len(r.Perfdata) > 0 {
+		line += " | " + strings.Join(r.Perfdata, " ")
+	}
+	return line
+}
+
+func perfdata(label string, value interface{}, unit string, warn interface{}, crit interface{}) string {
+	return fmt.Sprintf("%s=%v%s;%v;%v;0;", label, value, unit, warn, crit)
+}
+
+func failedReasons(results []solanahc.CheckResult) (reasons []string) {
+	for _, r := range results {
+		if r.Failed {
+			reasons = append(reasons, r.Reason)
+		}
+	}
+	return
+}
+
+// Returns the snapshot of the target, also when it failed to load, and of the references that loaded
+func NagiosNodes(states *solanahc.NodeStates, rpcNode string) (target *solanahc.NodeSnapshot, references []solanahc.NodeSnapshot) {
+	references = []solanahc.NodeSnapshot{}
+	for i := range states.States {
+		snapshot := states.States[i].Snapshot()
+		if snapshot.RpcNode == rpcNode {
+			target = &snapshot
+		} else {
+			references = append(references, snapshot)
+		}
+	}
+	for i := range states.Failed {
+		if snapshot := states.Failed[i].Snapshot(); snapshot.RpcNode == rpcNode {
+			target = &snapshot
+		}
+	}
+	return
+}
+
+// Runs the checks of the health-check package once with the warning and once with the critical thresholds
+func RunNagios(target *solanahc.NodeSnapshot, references []solanahc.NodeSnapshot, expectedReferences int) NagiosResult {
+	if target == nil {
+		return NagiosResult{Code: NagiosCritical, Summary: "couldn't load the node"}
+	}
+	if target.HasErrors {
+		return NagiosResult{Code: NagiosCritical, Summary: "error loading " + target.RpcNode + ": " + strings.Join(target.Errors, "; ")}
+	}
+	if expectedReferences > 0 && len(references) == 0 {
+		return NagiosResult{Code: NagiosUnknown, Summary: "couldn't load any reference node"}
+	}
+
+	ref := solanahc.NewReference(*target, references)
+	base := solanahc.CheckConfig{
+		BlockCheck:   *loadBlocks,
+		GenesisCheck: true,
+	}
+	warn, crit := base, base
+	warn.MaxSlotDiff, crit.MaxSlotDiff = *warnSlotDiff, *critSlotDiff
+	warn.MaxBlockDiff, crit.MaxBlockDiff = *warnBlockDiff, *critBlockDiff
+	warn.MinimumLedgerSize, crit.MinimumLedgerSize = *warnSlotsStored, *critSlotsStored
+
+	critReasons := failedReasons(crit.Run(target, references, ref))
+	warnReasons := failedReasons(warn.Run(target, references, ref))
+	if target.Latency >= *critLatency {
+		critReasons = append(critReasons, "latency")
+	} else if target.Latency >= *warnLatency {
+		warnReasons = append(warnReasons, "latency")
+	}
+
+	lag := int64(ref.Slot) - int64(target.CurrentSlot)
+	result := NagiosResult{Code: NagiosOk}
+	switch {
+	case len(critReasons) > 0:
+		result.Code = NagiosCritical
+		result.Summary = strings.Join(critReasons, ",") + ", "
+	case len(warnReasons) > 0:
+		result.Code = NagiosWarning
+		result.Summary = strings.Join(warnReasons, ",") + ", "
+	}
+	result.Summary += fmt.Sprintf("%s slot %d, %d slots behind %d references", target.RpcNode, target.CurrentSlot, lag, len(references))
+
+	result.Perfdata = append(result.Perfdata,
+		perfdata("slot_lag", lag, "", *warnSlotDiff, *critSlotDiff),
+		perfdata("slots_stored", uint64(target.CurrentSlot-target.MinimumSlot), "", optional(*warnSlotsStored), optional(*critSlotsStored)),
+	)
+	if *loadBlocks {
+		result.Perfdata = append(result.Perfdata, perfdata("block_diff", ref.CurMaxBlocks-target.CurEpochBlocks, "", *warnBlockDiff, *critBlockDiff))
+	}
+	result.Perfdata = append(result.Perfdata,
+		perfdata("latency", fmt.Sprintf("%.3f", target.Latency.Seconds()), "s", warnLatency.Seconds(), critLatency.Seconds()))
+	return result
+}
+
+// Thresholds which are disabled are left empty, a minimum is given as a Nagios range
+func optional(threshold int) string {
+	if threshold <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:", threshold)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+	"github.com/linuskendall/solana-rpc-health-check/rpc/rpctest"
+)
+
+func TestRunNagios(t *testing.T) {
+	reference := solanahc.NodeSnapshot{RpcNode: "http://ref:8899", MinimumSlot: 0, CurrentSlot: 1000, CurEpochBlocks: 500, GenesisHash: "genesis"}
+	target := func(lag uint64, blocks int, latency time.Duration) *solanahc.NodeSnapshot {
+		return &solanahc.NodeSnapshot{RpcNode: "http://node:8899", MinimumSlot: 100, CurrentSlot: reference.CurrentSlot - solanarpc.Slot(lag), CurEpochBlocks: blocks, GenesisHash: "genesis", Latency: latency}
+	}
+
+	tests := []struct {
+		name       string
+		target     *solanahc.NodeSnapshot
+		references []solanahc.NodeSnapshot
+		expected   int
+		result     string
+		code       int
+	}{
+		{
+			name: "ok", target: target(10, 500, 20*time.Millisecond), references: []solanahc.NodeSnapshot{reference}, expected: 1, code: NagiosOk,
+			result: "SOLANA RPC OK - http://node:8899 slot 990, 10 slots behind 1 references | slot_lag=10;50;200;0; slots_stored=890;;;0; block_diff=0;100;300;0; latency=0.020s;1;5;0;",
+		},
+		{
+			name: "warning", target: target(100, 500, 0), references: []solanahc.NodeSnapshot{reference}, expected: 1, code: NagiosWarning,
+			result: "SOLANA RPC WARNING - behind, http://node:8899 slot 900, 100 slots behind 1 references | slot_lag=100;50;200;0; slots_stored=800;;;0; block_diff=0;100;300;0; latency=0.000s;1;5;0;",
+		},
+		{
+			name: "critical", target: target(300, 100, 0), references: []solanahc.NodeSnapshot{reference}, expected: 1, code: NagiosCritical,
+			result: "SOLANA RPC CRITICAL - behind,blockdiff, http://node:8899 slot 700, 300 slots behind 1 references | slot_lag=300;50;200;0; slots_stored=600;;;0; block_diff=400;100;300;0; latency=0.000s;1;5;0;",
+		},
+		{
+			name: "latency", target: target(0, 500, 2*time.Second), references: []solanahc.NodeSnapshot{reference}, expected: 1, code: NagiosWarning,
+			result: "SOLANA RPC WARNING - latency, http://node:8899 slot 1000, 0 slots behind 1 references | slot_lag=0;50;200;0; slots_stored=900;;;0; block_diff=0;100;300;0; latency=2.000s;1;5;0;",
+		},
+		{
+			name: "critical latency over warning", target: target(100, 500, 5*time.Second), references: []solanahc.NodeSnapshot{reference}, expected: 1, code: NagiosCritical,
+			result: "SOLANA RPC CRITICAL - latency, http://node:8899 slot 900, 100 slots behind 1 references | slot_lag=100;50;200;0; slots_stored=800;;;0; block_diff=0;100;300;0; latency=5.000s;1;5;0;",
+		},
+		{
+			name: "no references", target: target(0, 500, 0), expected: 1, code: NagiosUnknown,
+			result: "SOLANA RPC UNKNOWN - couldn't load any reference node",
+		},
+		{
+			name: "not loaded", expected: 1, code: NagiosCritical,
+			result: "SOLANA RPC CRITICAL - couldn't load the node",
+		},
+		{
+			name: "failed to load", target: &solanahc.NodeSnapshot{RpcNode: "http://node:8899", HasErrors: true, Errors: []string{"connection refused"}}, references: []solanahc.NodeSnapshot{reference}, expected: 1, code: NagiosCritical,
+			result: "SOLANA RPC CRITICAL - error loading http://node:8899: connection refused",
+		},
+	}
+
+	for _, test := range tests {
+		result := RunNagios(test.target, test.references, test.expected)
+		if result.Code != test.code || result.String() != test.result {
+			t.Errorf("%s: got %d %q\nwant %d %q", test.name, result.Code, result.String(), test.code, test.result)
+		}
+	}
+}
+
+// The target is found among the nodes that failed to load, the failed references are left out
+func TestNagiosNodes(t *testing.T) {
+	node, reference, failed := rpctest.NewServer(), rpctest.NewServer(), rpctest.NewServer()
+	defer node.Close()
+	defer reference.Close()
+	defer failed.Close()
+
+	node.SetHTTPStatus(http.StatusServiceUnavailable)
+	failed.SetHTTPStatus(http.StatusServiceUnavailable)
+	states := solanahc.NewNodeStates([]string{node.URL, reference.URL, failed.URL}, false, true)
+	states.LoadStates()
+
+	target, references := NagiosNodes(states, node.URL)
+	if target == nil || !target.HasErrors {
+		t.Fatalf("got target %+v, want the failed node", target)
+	}
+	if len(references) != 1 || references[0].RpcNode != reference.URL {
+		t.Errorf("got references %+v", references)
+	}
+	if result := RunNagios(target, references, 2); result.Code != NagiosCritical {
+		t.Errorf("got %s for a target that failed to load", result)
+	}
+}
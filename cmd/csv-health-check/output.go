@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+var Formats = []string{"csv", "json", "table", "markdown"}
+
+func header(columns []Column) (names []string) {
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return
+}
+
+func values(columns []Column, row Row) (values []string) {
+	for _, c := range columns {
+		value := c.Value(row)
+		if value == nil {
+			values = append(values, "")
+			continue
+		}
+		values = append(values, fmt.Sprint(value))
+	}
+	return
+}
+
+func WriteRows(w io.Writer, format string, columns []Column, rows []Row) error {
+	switch format {
+	case "csv":
+		return writeCSV(w, columns, rows)
+	case "json":
+		return writeJSON(w, columns, rows)
+	case "table":
+		return writeTable(w, columns, rows)
+	case "markdown":
+		return writeMarkdown(w, columns, rows)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func writeCSV(w io.Writer, columns []Column, rows []Row) error {
+	cw := csv.NewWriter(w)
+	cw.Write(header(columns))
+	for _, row := range rows {
+		cw.Write(values(columns, row))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// A JSON object which keeps the keys in column order
+type jsonRow struct {
+	columns []Column
+	row     Row
+}
+
+func (r jsonRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, c := range r.columns {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(c.Name)
+		value, err := json.Marshal(c.Value(r.row))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// Writes an array of objects keyed by column name, numbers stay numbers
+func writeJSON(w io.Writer, columns []Column, rows []Row) error {
+	objects := []jsonRow{}
+	for _, row := range rows {
+		objects = append(objects, jsonRow{columns: columns, row: row})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(objects)
+}
+
+func writeTable(w io.Writer, columns []Column, rows []Row) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header(columns), "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(values(columns, row), "\t"))
+	}
+	return tw.Flush()
+}
+
+func markdownEscape(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
+
+func writeMarkdown(w io.Writer, columns []Column, rows []Row) error {
+	line := func(cells []string) {
+		for i := range cells {
+			cells[i] = markdownEscape(cells[i])
+		}
+		fmt.Fprintln(w, "| "+strings.Join(cells, " | ")+" |")
+	}
+
+	line(header(columns))
+	separator := []string{}
+	for range columns {
+		separator = append(separator, "---")
+	}
+	line(separator)
+	for _, row := range rows {
+		line(values(columns, row))
+	}
+	return nil
+}
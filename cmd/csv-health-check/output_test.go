@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+func testRows() []Row {
+	reference := solanahc.Reference{Slot: 1000}
+	return []Row{
+		{Id: 0, Time: time.Now(), State: solanahc.NodeSnapshot{RpcNode: "http://a:8899", CurrentSlot: 1000}, Reference: reference},
+		{Id: 1, Time: time.Now(), State: solanahc.NodeSnapshot{RpcNode: "http://b|c:8899", CurrentSlot: 990}, Reference: reference},
+	}
+}
+
+func TestWriteRows(t *testing.T) {
+	columns, err := ParseColumns("id,rpcNode,lag,slotsAdvanced")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format string
+		output string
+	}{
+		{format: "csv", output: "id,rpcNode,lag,slotsAdvanced\n0,http://a:8899,0,\n1,http://b|c:8899,10,\n"},
+		{format: "json", output: `[
+  {
+    "id": 0,
+    "rpcNode": "http://a:8899",
+    "lag": 0,
+    "slotsAdvanced": null
+  },
+  {
+    "id": 1,
+    "rpcNode": "http://b|c:8899",
+    "lag": 10,
+    "slotsAdvanced": null
+  }
+]
+`},
+		{format: "table", output: "id  rpcNode          lag  slotsAdvanced\n0   http://a:8899    0    \n1   http://b|c:8899  10   \n"},
+		{format: "markdown", output: "| id | rpcNode | lag | slotsAdvanced |\n| --- | --- | --- | --- |\n| 0 | http://a:8899 | 0 |  |\n| 1 | http://b\\|c:8899 | 10 |  |\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := WriteRows(&buf, test.format, columns, testRows()); err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if buf.String() != test.output {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.format, buf.String(), test.output)
+		}
+	}
+
+	if err := WriteRows(&bytes.Buffer{}, "xml", columns, testRows()); err == nil {
+		t.Errorf("unknown format was written")
+	}
+}
+
+// Without rows json is still an array and the other formats still have a header
+func TestWriteRowsEmpty(t *testing.T) {
+	columns, _ := ParseColumns("id,rpcNode")
+	for format, output := range map[string]string{"csv": "id,rpcNode\n", "json": "[]\n", "markdown": "| id | rpcNode |\n| --- | --- |\n"} {
+		var buf bytes.Buffer
+		if err := WriteRows(&buf, format, columns, nil); err != nil || buf.String() != output {
+			t.Errorf("%s: got %q (%v), want %q", format, buf.String(), err, output)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// A file which is rotated to path.1, path.2, ... once it's larger than maxSize
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	file *os.File
+	size int64
+}
+
+func OpenRotatingFile(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, keep: keep}
+	return r, r.open()
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (n int, err error) {
+	n, err = r.file.Write(p)
+	r.size += int64(n)
+	return
+}
+
+func (r *RotatingFile) Size() int64 {
+	return r.size
+}
+
+// Rotates the file if it has grown past its maximum size, returns whether it did
+func (r *RotatingFile) RotateIfFull() (bool, error) {
+	if r.maxSize <= 0 || r.size < r.maxSize {
+		return false, nil
+	}
+	if err := r.file.Close(); err != nil {
+		return false, err
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+	for i := r.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.keep > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return false, err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return false, err
+	}
+	return true, r.open()
+}
+
+func (r *RotatingFile) Close() error {
+	return r.file.Close()
+}
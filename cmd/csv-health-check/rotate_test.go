@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch.csv")
+	r, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Every write fills the file, the oldest rotation is dropped once keep is reached
+	for i := 1; i <= 4; i++ {
+		if rotated, err := r.RotateIfFull(); err != nil || rotated != (i > 1) {
+			t.Fatalf("write %d: got rotated %v (%v)", i, rotated, err)
+		}
+		fmt.Fprintf(r, "write %d...\n", i)
+	}
+
+	want := map[string]string{path: "write 4...\n", path + ".1": "write 3...\n", path + ".2": "write 2...\n"}
+	for path, content := range want {
+		if got := readFile(t, path); got != content {
+			t.Errorf("%s: got %q, want %q", path, got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than 2 rotated files: %v", err)
+	}
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch.csv")
+	if err := ioutil.WriteFile(path, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The size of an existing file counts, new writes are appended
+	r, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Size() != 5 {
+		t.Errorf("got size %d of the existing file, want 5", r.Size())
+	}
+	r.Write([]byte("678"))
+	if rotated, _ := r.RotateIfFull(); rotated || r.Size() != 8 {
+		t.Errorf("rotated below the maximum size, size %d", r.Size())
+	}
+	r.Write([]byte("90"))
+	if rotated, _ := r.RotateIfFull(); !rotated || r.Size() != 0 {
+		t.Errorf("didn't rotate at the maximum size, size %d", r.Size())
+	}
+	if got := readFile(t, path+".1"); got != "1234567890" {
+		t.Errorf("got rotated file %q", got)
+	}
+}
+
+func TestRotatingFileKeepNone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch.csv")
+	r, err := OpenRotatingFile(path, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("first\n"))
+	if rotated, err := r.RotateIfFull(); !rotated || err != nil {
+		t.Fatalf("got rotated %v (%v)", rotated, err)
+	}
+	r.Write([]byte("second\n"))
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("got %q, want only the write after the rotation", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("kept a rotated file with keep 0: %v", err)
+	}
+}
+
+// A maximum size of 0 disables the rotation
+func TestRotatingFileDisabled(t *testing.T) {
+	r, err := OpenRotatingFile(filepath.Join(t.TempDir(), "watch.csv"), 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("a long line which would be rotated otherwise\n"))
+	if rotated, _ := r.RotateIfFull(); rotated {
+		t.Errorf("rotated with rotation disabled")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+var (
+	watch       = flag.Duration("watch", 0, "Keep loading the states at this interval and print a row per node and iteration (disabled if 0)")
+	iterations  = flag.Int("count", 0, "Watch: stop after this many iterations (unlimited if 0)")
+	watchFor    = flag.Duration("for", 0, "Watch: stop after this long (unlimited if 0)")
+	outputPath  = flag.String("output", "", "Watch: write to this file instead of the terminal")
+	rotateSize  = flag.Int64("rotate-size", 10*1024*1024, "Watch: rotate the -output file once it's larger than this many bytes (disabled if 0)")
+	rotateCount = flag.Int("rotate-keep", 5, "Watch: number of rotated -output files to keep")
+)
+
+// Loads the states every -watch interval and writes rows with the deltas to the previous iteration.
+// CSV gets a single header per file, JSON a line per row and the tables are repeated every iteration.
+func Watch(states *solanahc.NodeStates, nodes []string, columns []Column) error {
+	columnsSet := false
+	flag.Visit(func(f *flag.Flag) {
+		columnsSet = columnsSet || f.Name == "columns"
+	})
+	if !columnsSet {
+		columns, _ = ParseColumns(DefaultWatchColumns)
+	}
+
+	var out io.Writer = os.Stdout
+	var file *RotatingFile
+	if *outputPath != "" {
+		var err error
+		if file, err = OpenRotatingFile(*outputPath, *rotateSize, *rotateCount); err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	// Appending to an existing csv file doesn't repeat the header
+	headerWritten := file != nil && file.Size() > 0
+
+	start := time.Now()
+	ticker := time.NewTicker(*watch)
+	defer ticker.Stop()
+
+	previous := map[string]Row{}
+	for i := 1; ; i++ {
+		if _, err := states.LoadStates(); err != nil {
+			log.Println("error: ", err)
+		}
+		rows := BuildRows(states, nodes, time.Now(), previous, WithFailed(columns))
+
+		if file != nil {
+			rotated, err := file.RotateIfFull()
+			if err != nil {
+				return err
+			}
+			headerWritten = headerWritten && !rotated
+		}
+
+		var err error
+		switch *format {
+		case "csv":
+			cw := csv.NewWriter(out)
+			if !headerWritten {
+				cw.Write(header(columns))
+				headerWritten = true
+			}
+			for _, row := range rows {
+				cw.Write(values(columns, row))
+			}
+			cw.Flush()
+			err = cw.Error()
+		case "json":
+			encoder := json.NewEncoder(out)
+			for _, row := range rows {
+				if err = encoder.Encode(jsonRow{columns: columns, row: row}); err != nil {
+					break
+				}
+			}
+		default:
+			fmt.Fprintln(out, time.Now().Format(time.RFC3339))
+			if err = WriteRows(out, *format, columns, rows); err == nil {
+				_, err = fmt.Fprintln(out)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			previous[row.State.RpcNode] = row
+		}
+
+		if *iterations > 0 && i >= *iterations {
+			return nil
+		}
+		if *watchFor > 0 && time.Since(start)+*watch > *watchFor {
+			return nil
+		}
+		<-ticker.C
+	}
+}
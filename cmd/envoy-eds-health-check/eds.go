@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// Every envoy gets the same endpoints, so all nodes share a single snapshot
+const snapshotNode = "solana-rpc"
+
+type sharedHash struct{}
+
+func (sharedHash) ID(node *core.Node) string {
+	return snapshotNode
+}
+
+// Serves the health of the monitored backends as a ClusterLoadAssignment over EDS
+type EDSServer struct {
+	cluster    string
+	weight     uint32
+	warnWeight uint32
+	monitor    *solanahc.Monitor
+	cache      cache.SnapshotCache
+
+	mu         sync.Mutex
+	version    int
+	assignment *endpoint.ClusterLoadAssignment
+	// The last address every backend resolved to
+	addresses map[string]resolvedAddress
+}
+
+type resolvedAddress struct {
+	address string
+	port    uint32
+}
+
+// Replaced in tests
+var lookupIP = net.LookupIP
+
+func NewEDSServer(monitor *solanahc.Monitor, cluster string, weight uint32, warnWeight uint32) *EDSServer {
+	return &EDSServer{
+		cluster:    cluster,
+		weight:     weight,
+		warnWeight: warnWeight,
+		monitor:    monitor,
+		cache:      cache.NewSnapshotCache(false, sharedHash{}, nil),
+		addresses:  map[string]resolvedAddress{},
+	}
+}
+
+// Rebuilds the assignment and pushes a new snapshot if anything changed
+func (e *EDSServer) Update() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	assignment := e.buildAssignment()
+
+	if e.assignment != nil && proto.Equal(e.assignment, assignment) {
+		return
+	}
+	e.version++
+	e.assignment = assignment
+
+	snapshot := cache.NewSnapshot(strconv.Itoa(e.version), []types.Resource{assignment}, nil, nil, nil, nil, nil)
+	if err := e.cache.SetSnapshot(snapshotNode, snapshot); err != nil {
+		log.Println("error setting snapshot ", err)
+		return
+	}
+	log.Println("pushed endpoints version ", e.version)
+}
+
+// Must be called with mu held
+func (e *EDSServer) buildAssignment() *endpoint.ClusterLoadAssignment {
+	endpoints := []*endpoint.LbEndpoint{}
+	for _, t := range e.monitor.Targets() {
+		health, weight := e.endpointHealth(t)
+
+		// A backend which doesn't resolve any more keeps its last address but is
+		// unhealthy, one which never resolved can't be served yet
+		address, port, err := endpointAddress(t.RpcUri)
+		if err != nil {
+			last, ok := e.addresses[t.RpcUri]
+			if !ok {
+				log.Println("couldn't resolve ", t.RpcUri, " ", err)
+				continue
+			}
+			log.Println("couldn't resolve ", t.RpcUri, " ", err, " keeping ", last.address, " as unhealthy")
+			address, port = last.address, last.port
+			health = core.HealthStatus_UNHEALTHY
+		} else {
+			e.addresses[t.RpcUri] = resolvedAddress{address: address, port: port}
+		}
+		log.Println("endpoint ", t.RpcUri, " is: ", t.GetStatus(), " health=", health, " weight=", weight)
+
+		endpoints = append(endpoints, &endpoint.LbEndpoint{
+			HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+				Endpoint: &endpoint.Endpoint{
+					Address: &core.Address{
+						Address: &core.Address_SocketAddress{
+							SocketAddress: &core.SocketAddress{
+								Protocol:      core.SocketAddress_TCP,
+								Address:       address,
+								PortSpecifier: &core.SocketAddress_PortValue{PortValue: port},
+							},
+						},
+					},
+					Hostname: t.RpcUri,
+				},
+			},
+			HealthStatus:        health,
+			LoadBalancingWeight: wrapperspb.UInt32(weight),
+		})
+	}
+
+	return &endpoint.ClusterLoadAssignment{
+		ClusterName: e.cluster,
+		Endpoints:   []*endpoint.LocalityLbEndpoints{{LbEndpoints: endpoints}},
+	}
+}
+
+// Maps the verdict onto envoy's health status, nodes with failing warn checks get a reduced weight
+func (e *EDSServer) endpointHealth(t *solanahc.HealthState) (core.HealthStatus, uint32) {
+	status, _ := t.GetVerdict()
+	switch status {
+	case solanahc.StatusUp:
+		if len(t.Warnings()) > 0 {
+			return core.HealthStatus_HEALTHY, e.warnWeight
+		}
+		return core.HealthStatus_HEALTHY, e.weight
+	case solanahc.StatusDrain:
+		return core.HealthStatus_DRAINING, e.weight
+	default:
+		return core.HealthStatus_UNHEALTHY, e.weight
+	}
+}
+
+// Returns the ip and port of an rpc uri, the port defaults to the one of the scheme
+func endpointAddress(rpcUri string) (address string, port uint32, err error) {
+	u, err := url.Parse(rpcUri)
+	if err != nil {
+		return
+	}
+	if u.Hostname() == "" {
+		err = fmt.Errorf("no host in %q", rpcUri)
+		return
+	}
+
+	portName := u.Port()
+	if portName == "" {
+		portName = u.Scheme
+	}
+	p, err := net.LookupPort("tcp", portName)
+	if err != nil {
+		return
+	}
+
+	ips, err := lookupIP(u.Hostname())
+	if err != nil {
+		return
+	}
+	return ips[0].String(), uint32(p), nil
+}
+
+func (e *EDSServer) Serve(listener net.Listener) error {
+	grpcServer := grpc.NewServer()
+	callbacks := server.CallbackFuncs{
+		StreamOpenFunc: func(ctx context.Context, id int64, typeURL string) error {
+			log.Println("xds stream opened ", id, " type=", typeURL)
+			return nil
+		},
+		StreamClosedFunc: func(id int64) {
+			log.Println("xds stream closed ", id)
+		},
+	}
+	xds := server.NewServer(context.Background(), e.cache, callbacks)
+
+	endpointservice.RegisterEndpointDiscoveryServiceServer(grpcServer, xds)
+	discovery.RegisterAggregatedDiscoveryServiceServer(grpcServer, xds)
+
+	return grpcServer.Serve(listener)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	resource "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"google.golang.org/grpc"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	"github.com/linuskendall/solana-rpc-health-check/health-check/simulation"
+)
+
+// Stands in for envoy, subscribing to the endpoints of a cluster
+type fakeEnvoy struct {
+	t      *testing.T
+	stream endpointservice.EndpointDiscoveryService_StreamEndpointsClient
+	last   *discovery.DiscoveryResponse
+}
+
+func newFakeEnvoy(t *testing.T, addr string) *fakeEnvoy {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	stream, err := endpointservice.NewEndpointDiscoveryServiceClient(conn).StreamEndpoints(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeEnvoy{t: t, stream: stream}
+}
+
+// Requests the cluster, acknowledging the last response, and returns the next assignment
+func (f *fakeEnvoy) next(cluster string) map[string]*endpoint.LbEndpoint {
+	req := &discovery.DiscoveryRequest{
+		Node:          &core.Node{Id: "envoy"},
+		TypeUrl:       resource.EndpointType,
+		ResourceNames: []string{cluster},
+	}
+	if f.last != nil {
+		req.VersionInfo = f.last.VersionInfo
+		req.ResponseNonce = f.last.Nonce
+	}
+	if err := f.stream.Send(req); err != nil {
+		f.t.Fatal(err)
+	}
+
+	resp, err := f.stream.Recv()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.last = resp
+	if len(resp.Resources) != 1 {
+		f.t.Fatalf("got %d resources, want 1", len(resp.Resources))
+	}
+
+	assignment := &endpoint.ClusterLoadAssignment{}
+	if err := resp.Resources[0].UnmarshalTo(assignment); err != nil {
+		f.t.Fatal(err)
+	}
+	if assignment.ClusterName != cluster {
+		f.t.Fatalf("got cluster %q, want %q", assignment.ClusterName, cluster)
+	}
+
+	endpoints := map[string]*endpoint.LbEndpoint{}
+	for _, locality := range assignment.Endpoints {
+		for _, lb := range locality.LbEndpoints {
+			endpoints[lb.GetEndpoint().Hostname] = lb
+		}
+	}
+	return endpoints
+}
+
+func checkEndpoint(t *testing.T, endpoints map[string]*endpoint.LbEndpoint, rpcUri string, health core.HealthStatus, weight uint32) {
+	t.Helper()
+
+	lb, ok := endpoints[rpcUri]
+	if !ok {
+		t.Fatalf("no endpoint for %s", rpcUri)
+	}
+	if lb.HealthStatus != health {
+		t.Errorf("%s health is %v, want %v", rpcUri, lb.HealthStatus, health)
+	}
+	if lb.LoadBalancingWeight.GetValue() != weight {
+		t.Errorf("%s weight is %d, want %d", rpcUri, lb.LoadBalancingWeight.GetValue(), weight)
+	}
+}
+
+func TestEDSServer(t *testing.T) {
+	cluster := simulation.NewCluster()
+	t.Cleanup(cluster.Close)
+	healthy, behind := cluster.Healthy, cluster.Behind
+
+	monitor := cluster.Monitor([]*solanahc.HealthState{cluster.HealthState(healthy.URL), cluster.HealthState(behind.URL)})
+	monitor.Check()
+
+	eds := NewEDSServer(monitor, "solana-rpc", 100, 50)
+	eds.Update()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go eds.Serve(listener)
+
+	envoy := newFakeEnvoy(t, listener.Addr().String())
+	endpoints := envoy.next("solana-rpc")
+	if len(endpoints) != 2 {
+		t.Fatalf("got %d endpoints, want 2", len(endpoints))
+	}
+	checkEndpoint(t, endpoints, healthy.URL, core.HealthStatus_HEALTHY, 100)
+	checkEndpoint(t, endpoints, behind.URL, core.HealthStatus_UNHEALTHY, 100)
+
+	// A backend which stops resolving keeps its last address and is reported unhealthy
+	lookupIP = func(host string) ([]net.IP, error) {
+		return nil, errors.New("no such host")
+	}
+	defer func() { lookupIP = net.LookupIP }()
+	address := endpoints[healthy.URL].GetEndpoint().Address.GetSocketAddress().Address
+
+	eds.Update()
+	endpoints = envoy.next("solana-rpc")
+	checkEndpoint(t, endpoints, healthy.URL, core.HealthStatus_UNHEALTHY, 100)
+	if got := endpoints[healthy.URL].GetEndpoint().Address.GetSocketAddress().Address; got != address {
+		t.Errorf("address is %s after a failed lookup, want %s", got, address)
+	}
+}
+
+func TestEndpointAddress(t *testing.T) {
+	tests := []struct {
+		rpcUri  string
+		address string
+		port    uint32
+		err     bool
+	}{
+		{rpcUri: "http://127.0.0.1:8899", address: "127.0.0.1", port: 8899},
+		{rpcUri: "http://127.0.0.1", address: "127.0.0.1", port: 80},
+		{rpcUri: "https://[::1]", address: "::1", port: 443},
+		{rpcUri: "127.0.0.1:8899", err: true},
+		{rpcUri: "http://:8899", err: true},
+	}
+
+	for _, test := range tests {
+		address, port, err := endpointAddress(test.rpcUri)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.rpcUri)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.rpcUri, err)
+			continue
+		}
+		if address != test.address || port != test.port {
+			t.Errorf("%s: got %s:%d, want %s:%d", test.rpcUri, address, port, test.address, test.port)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+const (
+	HEALTH_UPDATE_INTERVAL time.Duration = 10 * time.Second
+)
+
+var (
+	addr            = flag.String("addr", ":18000", "Listen address of the xDS gRPC server")
+	backends        = flag.String("backends", "http://localhost:8899", "Comma separated list of Solana RPC URIs served as endpoints")
+	clusterName     = flag.String("cluster", "solana-rpc", "Name of the envoy cluster the endpoints are assigned to")
+	weight          = flag.Uint("weight", 100, "Load balancing weight of a healthy endpoint")
+	warnWeight      = flag.Uint("warn-weight", 50, "Load balancing weight of a healthy endpoint with failing warn checks")
+	compareBackends = flag.Bool("compare-backends", false, "Also compare every backend against the other backends")
+	checkFlags      = solanahc.RegisterCheckFlags(flag.CommandLine)
+)
+
+func main() {
+	flag.Parse()
+
+	levels, fallback, err := checkFlags.Levels()
+	if err != nil {
+		log.Fatal("invalid -check-levels: ", err)
+	}
+
+	config := checkFlags.Config()
+
+	targets := []*solanahc.HealthState{}
+	for _, backend := range solanahc.SplitList(*backends) {
+		targets = append(targets, solanahc.NewHealthState(backend, config, levels, fallback))
+	}
+	if len(targets) == 0 {
+		log.Fatal("need at least one backend")
+	}
+	servers := checkFlags.References()
+
+	log.Println("Serving EDS on ", *addr, "cluster", *clusterName, "backends", *backends, "reference servers", servers)
+
+	monitor := solanahc.NewMonitor(targets, servers)
+	monitor.CompareTargets = *compareBackends
+
+	eds := NewEDSServer(monitor, *clusterName, uint32(*weight), uint32(*warnWeight))
+	eds.Update()
+	monitor.OnEvaluated(eds.Update)
+	go monitor.Run(HEALTH_UPDATE_INTERVAL)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal("listen error: ", err)
+	}
+	if err := eds.Serve(listener); err != nil {
+		log.Fatal("serve error: ", err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// What haproxy sent with agent-send, either a bare backend name or key=value pairs
+type AgentRequest struct {
+	Raw     string
+	Backend string
+	Params  map[string]string
+}
+
+func ParseAgentRequest(payload string) (req AgentRequest) {
+	req.Raw = strings.TrimSpace(payload)
+	req.Params = map[string]string{}
+
+	for _, field := range strings.Fields(req.Raw) {
+		if i := strings.Index(field, "="); i > 0 {
+			req.Params[field[:i]] = field[i+1:]
+		} else if req.Backend == "" {
+			req.Backend = field
+		}
+	}
+	if backend, ok := req.Params["backend"]; ok {
+		req.Backend = backend
+	}
+	return
+}
+
+// Serves the haproxy agent-check protocol
+type AgentServer struct {
+	responder    *Responder
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	allow        []*net.IPNet
+	slots        chan struct{}
+
+	stopping uint32
+	wg       sync.WaitGroup
+	listener net.Listener
+}
+
+func NewAgentServer(responder *Responder, readTimeout time.Duration, writeTimeout time.Duration, maxConns int, allow []*net.IPNet) *AgentServer {
+	return &AgentServer{
+		responder:    responder,
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+		allow:        allow,
+		slots:        make(chan struct{}, maxConns),
+	}
+}
+
+// Parses a comma separated list of ips and networks
+func ParseAllowList(list string) (allow []*net.IPNet, err error) {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			allow = append(allow, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, perr := net.ParseCIDR(entry)
+		if perr != nil {
+			return nil, perr
+		}
+		allow = append(allow, network)
+	}
+	return
+}
+
+// Connections over unix sockets are always allowed
+func (a *AgentServer) allowed(addr net.Addr) bool {
+	if len(a.allow) == 0 {
+		return true
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return addr.Network() == "unix"
+	}
+	for _, network := range a.allow {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AgentServer) Serve(listener net.Listener) error {
+	a.listener = listener
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if atomic.LoadUint32(&a.stopping) == 1 && errors.Is(err, net.ErrClosed) {
+				a.wg.Wait()
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				log.Println("accept error ", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		if !a.allowed(conn.RemoteAddr()) {
+			log.Println("rejecting connection from ", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		select {
+		case a.slots <- struct{}{}:
+		default:
+			log.Println("too many connections, rejecting ", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		a.wg.Add(1)
+		go func() {
+			defer func() {
+				<-a.slots
+				a.wg.Done()
+			}()
+			a.handle(conn)
+		}()
+	}
+}
+
+func (a *AgentServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	// haproxy only sends something when agent-send is configured, so reading is opt in
+	// and a read timeout just means there is no payload
+	var payload string
+	if a.readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(a.readTimeout))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil && err != io.EOF && !isTimeout(err) {
+			log.Println("error reading agent request ", err)
+		}
+		payload = line
+	}
+	req := ParseAgentRequest(payload)
+
+	var answer string
+	if atomic.LoadUint32(&a.stopping) == 1 {
+		answer = string(OverrideDrain) + " #stopping"
+	} else {
+		answer = a.responder.Answer(req)
+	}
+	log.Println("answering health request from ", conn.RemoteAddr(), " request=", req.Raw, " node is: ", answer)
+
+	if a.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(a.writeTimeout))
+	}
+	if _, err := conn.Write([]byte(answer + "\n")); err != nil {
+		log.Println("error writing agent answer ", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Answers drain for the grace period, then stops accepting, Serve returns once open connections are done
+func (a *AgentServer) Shutdown(grace time.Duration) {
+	atomic.StoreUint32(&a.stopping, 1)
+	log.Println("shutting down, answering drain for ", grace)
+	time.Sleep(grace)
+
+	if a.listener != nil {
+		a.listener.Close()
+	}
+}
+
+// Listens on a tcp address or on a unix socket given as unix:/path
+func listen(addr string) (listener net.Listener, err error) {
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+		// Only clean up a socket left behind by a previous run
+		if info, serr := os.Lstat(path); serr == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("%s exists and is not a socket", path)
+			}
+			os.Remove(path)
+		}
+		listener, err = net.Listen("unix", path)
+		if err == nil {
+			err = os.Chmod(path, 0660)
+		}
+		return
+	}
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OverrideMode string
+
+const (
+	OverrideMaint     = OverrideMode("maint")
+	OverrideDrain     = OverrideMode("drain")
+	OverrideForceUp   = OverrideMode("force-up")
+	OverrideForceDown = OverrideMode("force-down")
+)
+
+// An operator set state for a backend which takes precedence over the health checks
+type Override struct {
+	Backend string       `json:"backend"`
+	Mode    OverrideMode `json:"mode"`
+	Reason  string       `json:"reason,omitempty"`
+	Created time.Time    `json:"created"`
+	Expires *time.Time   `json:"expires,omitempty"`
+}
+
+func (o *Override) Expired(now time.Time) bool {
+	return o.Expires != nil && now.After(*o.Expires)
+}
+
+type OverrideRequest struct {
+	Backend string       `json:"backend"`
+	Mode    OverrideMode `json:"mode"`
+	Reason  string       `json:"reason"`
+	// Duration string such as "30m", empty for no expiry
+	TTL string `json:"ttl"`
+}
+
+type Control struct {
+	token     string
+	statePath string
+	backends  []string
+	audit     *log.Logger
+
+	mu        sync.Mutex
+	overrides map[string]Override
+}
+
+func NewControl(backends []string, token string, statePath string, audit *log.Logger) (c *Control, err error) {
+	c = &Control{
+		token:     token,
+		statePath: statePath,
+		backends:  backends,
+		audit:     audit,
+		overrides: make(map[string]Override),
+	}
+
+	err = c.load()
+	return
+}
+
+// Loads the persisted overrides, a missing state file is not an error
+func (c *Control) load() (err error) {
+	if c.statePath == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(c.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	var overrides []Override
+	if err = json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("couldn't parse control state %s: %v", c.statePath, err)
+	}
+
+	c.mu.Lock()
+	for _, o := range overrides {
+		c.overrides[o.Backend] = o
+	}
+	c.mu.Unlock()
+
+	log.Println("loaded ", len(overrides), " overrides from ", c.statePath)
+	return
+}
+
+// Writes the overrides to the state file, must be called with mu held
+func (c *Control) persist() {
+	if c.statePath == "" {
+		return
+	}
+
+	overrides := make([]Override, 0, len(c.overrides))
+	for _, o := range c.overrides {
+		overrides = append(overrides, o)
+	}
+
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		log.Println("error encoding control state ", err)
+		return
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial state file
+	tmp, err := ioutil.TempFile(filepath.Dir(c.statePath), ".overrides")
+	if err != nil {
+		log.Println("error writing control state ", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.statePath)
+	}
+	if err != nil {
+		log.Println("error writing control state ", err)
+		os.Remove(tmp.Name())
+	}
+}
+
+func (c *Control) isBackend(backend string) bool {
+	for _, b := range c.backends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Control) Set(o Override, source string) {
+	c.mu.Lock()
+	c.overrides[o.Backend] = o
+	c.persist()
+	c.mu.Unlock()
+
+	c.audit.Printf("set backend=%s mode=%s reason=%q expires=%s source=%s", o.Backend, o.Mode, o.Reason, formatExpiry(o.Expires), source)
+}
+
+func (c *Control) Clear(backend string, source string) (ok bool) {
+	c.mu.Lock()
+	_, ok = c.overrides[backend]
+	if ok {
+		delete(c.overrides, backend)
+		c.persist()
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.audit.Printf("clear backend=%s source=%s", backend, source)
+	}
+	return
+}
+
+// Returns the active override for a backend, expired overrides are removed
+func (c *Control) Get(backend string) (o Override, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	o, ok = c.overrides[backend]
+	if ok && o.Expired(time.Now()) {
+		delete(c.overrides, backend)
+		c.persist()
+		c.audit.Printf("expire backend=%s mode=%s reason=%q", o.Backend, o.Mode, o.Reason)
+		return Override{}, false
+	}
+	return
+}
+
+func (c *Control) List() (overrides []Override) {
+	overrides = []Override{}
+	for _, backend := range c.backends {
+		if o, ok := c.Get(backend); ok {
+			overrides = append(overrides, o)
+		}
+	}
+	return
+}
+
+func (c *Control) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/overrides", c.authenticate(c.handleOverrides))
+	return mux
+}
+
+func (c *Control) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.token != "" {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(c.token)) != 1 {
+				c.audit.Printf("unauthorized method=%s source=%s", r.Method, requestSource(r))
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// GET lists the overrides, POST sets one and DELETE (?backend=) clears one
+func (c *Control) handleOverrides(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, c.List())
+	case http.MethodPost:
+		var req OverrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		o, err := c.newOverride(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c.Set(o, requestSource(r))
+		writeJSON(w, http.StatusOK, o)
+	case http.MethodDelete:
+		backend := r.URL.Query().Get("backend")
+		if backend == "" && len(c.backends) == 1 {
+			backend = c.backends[0]
+		}
+
+		if !c.Clear(backend, requestSource(r)) {
+			http.Error(w, "no override for backend", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Control) newOverride(req OverrideRequest) (o Override, err error) {
+	// Default to the only backend this agent checks
+	if req.Backend == "" && len(c.backends) == 1 {
+		req.Backend = c.backends[0]
+	}
+	if !c.isBackend(req.Backend) {
+		err = fmt.Errorf("unknown backend %q", req.Backend)
+		return
+	}
+
+	switch req.Mode {
+	case OverrideMaint, OverrideDrain, OverrideForceUp, OverrideForceDown:
+	default:
+		err = fmt.Errorf("unknown mode %q", req.Mode)
+		return
+	}
+
+	o = Override{
+		Backend: req.Backend,
+		Mode:    req.Mode,
+		Reason:  req.Reason,
+		Created: time.Now(),
+	}
+
+	if req.TTL != "" {
+		ttl, perr := time.ParseDuration(req.TTL)
+		if perr != nil || ttl <= 0 {
+			err = errors.New("invalid ttl")
+			return
+		}
+		expires := o.Created.Add(ttl)
+		o.Expires = &expires
+	}
+	return
+}
+
+// Without a token the control API may only listen on a unix socket, where the file permissions guard it
+func checkControlAuth(addr string, token string) error {
+	if token == "" && !strings.HasPrefix(addr, "unix:") {
+		return errors.New("the control api requires -control-token-file unless it listens on a unix socket")
+	}
+	return nil
+}
+
+func requestSource(r *http.Request) string {
+	if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+		return "unix"
+	}
+	return r.RemoteAddr
+}
+
+func formatExpiry(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Serves the control API on a tcp address or on a unix socket given as unix:/path
+func (c *Control) ListenAndServe(addr string) (err error) {
+	listener, err := listen(addr)
+	if err != nil {
+		return
+	}
+
+	log.Println("control api listening on ", addr)
+	return http.Serve(listener, c.Handler())
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBackend = "http://node:8899"
+
+// Returns a control API for testBackend and the buffer its audit log is written to
+func newTestControl(t *testing.T, token string, statePath string) (*Control, *bytes.Buffer) {
+	audit := &bytes.Buffer{}
+	c, err := NewControl([]string{testBackend}, token, statePath, log.New(audit, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, audit
+}
+
+func request(t *testing.T, client *http.Client, method string, url string, token string, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestControlToken(t *testing.T) {
+	c, audit := newTestControl(t, "secret", "")
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		auth string
+		code int
+	}{
+		{name: "missing", auth: "", code: http.StatusUnauthorized},
+		{name: "wrong", auth: "Bearer other", code: http.StatusUnauthorized},
+		{name: "prefix", auth: "Bearer secretsecret", code: http.StatusUnauthorized},
+		{name: "scheme", auth: "Basic secret", code: http.StatusUnauthorized},
+		{name: "valid", auth: "Bearer secret", code: http.StatusOK},
+	}
+	for _, test := range tests {
+		resp := request(t, server.Client(), http.MethodPost, server.URL+"/overrides", test.auth, `{"mode":"maint"}`)
+		if resp.StatusCode != test.code {
+			t.Errorf("%s token: got status %d, want %d", test.name, resp.StatusCode, test.code)
+		}
+	}
+
+	// Only the request with the valid token may have changed anything
+	if overrides := c.List(); len(overrides) != 1 || overrides[0].Mode != OverrideMaint {
+		t.Errorf("unexpected overrides %+v", overrides)
+	}
+	if n := strings.Count(audit.String(), "unauthorized"); n != 4 {
+		t.Errorf("got %d unauthorized requests in the audit log, want 4:\n%s", n, audit)
+	}
+}
+
+func TestCheckControlAuth(t *testing.T) {
+	tests := []struct {
+		addr  string
+		token string
+		ok    bool
+	}{
+		{addr: "unix:/run/agent/control.sock", token: "", ok: true},
+		{addr: "unix:/run/agent/control.sock", token: "secret", ok: true},
+		{addr: "127.0.0.1:9997", token: "secret", ok: true},
+		{addr: "127.0.0.1:9997", token: "", ok: false},
+		{addr: ":9997", token: "", ok: false},
+	}
+	for _, test := range tests {
+		if err := checkControlAuth(test.addr, test.token); (err == nil) != test.ok {
+			t.Errorf("%s with token %q: got %v, want ok %v", test.addr, test.token, err, test.ok)
+		}
+	}
+}
+
+// Without a token the API is served on a unix socket only
+func TestControlUnixSocket(t *testing.T) {
+	c, audit := newTestControl(t, "", "")
+	path := filepath.Join(t.TempDir(), "control.sock")
+	listener, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(listener, c.Handler())
+	defer listener.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp := request(t, client, http.MethodPost, "http://unix/overrides", "", `{"mode":"drain","reason":"upgrade"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	if o, ok := c.Get(testBackend); !ok || o.Mode != OverrideDrain || o.Reason != "upgrade" {
+		t.Errorf("unexpected override %+v", o)
+	}
+	if !strings.Contains(audit.String(), "source=unix") {
+		t.Errorf("the audit log doesn't name the unix socket as source:\n%s", audit)
+	}
+}
+
+func TestControlOverrides(t *testing.T) {
+	c, audit := newTestControl(t, "", "")
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+	client := server.Client()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{method: http.MethodPost, path: "/overrides", body: `{"mode":"sleep"}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/overrides", body: `{"backend":"http://other:8899","mode":"maint"}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/overrides", body: `{"mode":"maint","ttl":"soon"}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/overrides", body: `{"mode":"maint","ttl":"-1m"}`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/overrides", body: `not json`, code: http.StatusBadRequest},
+		{method: http.MethodDelete, path: "/overrides", code: http.StatusNotFound},
+		{method: http.MethodPost, path: "/overrides", body: `{"backend":"` + testBackend + `","mode":"force-down","ttl":"30m"}`, code: http.StatusOK},
+		{method: http.MethodPut, path: "/overrides", code: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, path: "/overrides?backend=" + testBackend, code: http.StatusNoContent},
+		{method: http.MethodDelete, path: "/overrides", code: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		resp := request(t, client, test.method, server.URL+test.path, "", test.body)
+		if resp.StatusCode != test.code {
+			t.Errorf("%s %s %s: got status %d, want %d", test.method, test.path, test.body, resp.StatusCode, test.code)
+		}
+	}
+
+	audited := audit.String()
+	if !strings.Contains(audited, "set backend="+testBackend+" mode=force-down") || !strings.Contains(audited, "clear backend="+testBackend) {
+		t.Errorf("the audit log is missing the set and the clear:\n%s", audited)
+	}
+	if strings.Count(audited, "\n") != 2 {
+		t.Errorf("rejected requests were written to the audit log:\n%s", audited)
+	}
+}
+
+func TestControlList(t *testing.T) {
+	c, _ := newTestControl(t, "", "")
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+
+	c.Set(Override{Backend: testBackend, Mode: OverrideForceUp, Reason: "testing"}, "test")
+	resp, err := server.Client().Get(server.URL + "/overrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var overrides []Override
+	if err := json.NewDecoder(resp.Body).Decode(&overrides); err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != 1 || overrides[0].Mode != OverrideForceUp || overrides[0].Reason != "testing" {
+		t.Errorf("unexpected overrides %+v", overrides)
+	}
+}
+
+func TestControlExpiry(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "overrides.json")
+	c, audit := newTestControl(t, "", statePath)
+
+	expires := time.Now().Add(time.Hour)
+	c.Set(Override{Backend: testBackend, Mode: OverrideMaint, Created: time.Now(), Expires: &expires}, "test")
+	if _, ok := c.Get(testBackend); !ok {
+		t.Fatal("override expired before its time")
+	}
+
+	expired := time.Now().Add(-time.Second)
+	c.Set(Override{Backend: testBackend, Mode: OverrideMaint, Reason: "window", Created: time.Now(), Expires: &expired}, "test")
+	if o, ok := c.Get(testBackend); ok {
+		t.Errorf("got expired override %+v", o)
+	}
+	if len(c.List()) != 0 {
+		t.Errorf("expired override is still listed")
+	}
+	if !strings.Contains(audit.String(), `expire backend=`+testBackend+` mode=maint reason="window"`) {
+		t.Errorf("the audit log is missing the expiry:\n%s", audit)
+	}
+
+	// The expiry is persisted as well
+	data, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := strings.TrimSpace(string(data)); state != "[]" {
+		t.Errorf("expired override is still in the state file: %s", state)
+	}
+}
+
+func TestControlPersistence(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "overrides.json")
+	c, _ := newTestControl(t, "", statePath)
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	c.Set(Override{Backend: testBackend, Mode: OverrideDrain, Reason: "upgrade", Created: time.Now(), Expires: &expires}, "test")
+
+	reloaded, _ := newTestControl(t, "", statePath)
+	o, ok := reloaded.Get(testBackend)
+	if !ok || o.Mode != OverrideDrain || o.Reason != "upgrade" || o.Expires == nil || !o.Expires.Equal(expires) {
+		t.Errorf("unexpected override after reloading %+v", o)
+	}
+
+	reloaded.Clear(testBackend, "test")
+	if reloaded, _ = newTestControl(t, "", statePath); len(reloaded.List()) != 0 {
+		t.Errorf("cleared override came back after reloading")
+	}
+
+	// A missing state file is an empty state, a corrupted one an error
+	if _, err := NewControl([]string{testBackend}, "", filepath.Join(t.TempDir(), "missing.json"), log.New(ioutil.Discard, "", 0)); err != nil {
+		t.Errorf("missing state file: %v", err)
+	}
+	corrupted := filepath.Join(t.TempDir(), "corrupted.json")
+	if err := ioutil.WriteFile(corrupted, []byte("[{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewControl([]string{testBackend}, "", corrupted, log.New(ioutil.Discard, "", 0)); err == nil {
+		t.Errorf("corrupted state file was loaded")
+	}
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
-	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/firstrow/tcp_server"
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
 )
 
 const (
@@ -17,30 +23,40 @@ const (
 )
 
 var (
-	rpcURI                     = flag.String("rpc", "http://localhost:8899", "Solana RPC URI (including protocol and path)")
-	addr                       = flag.String("addr", ":9999", "Listen address")
-	rpcTimeout                 = flag.Int("rpc-timeout", 10, "Timeout per rpc call")
-	maintPath                  = flag.String("maintfile", "/etc/haproxy/maintenance", "A file which if exists puts this server in maintenance mode")
-	MAX_SLOT_DIFF              = flag.Int("slot-diff", 200, "Maximum divergence in slots")
-	MAX_BLOCK_DIFF             = flag.Int("block-diff", 300, "Maximum divergence in blocks")
-	UP_THRESHOLD               = flag.Int("up", 2, "Number of consecutive health checks that report up before node is healthy")
-	DOWN_THRESHOLD             = flag.Int("down", 4, "Number of consecutive health checks that report down before node is healthy")
-	BLOCK_CHECK_ENABLED        = flag.Bool("enable-block-check", false, "Enable checking block storage for consecutive blocks (expensive)")
-	MAX_TRANSMIT_CHECK_ENABLED = flag.Bool("enable-max-retransmit-check", true, "Enable checking max retransmit slots")
-	MINIMUM_LEDGER_SIZE        = flag.Int("minimum-ledger-size", 0, "Minimum number of slots that node needs to have stored")
-	REFERENCE_SERVERS          = flag.String("reference-servers", "", "Enables checking the current slot against provided comma separated list of reference servers")
+	rpcURI           = flag.String("rpc", "http://localhost:8899", "Solana RPC URI (including protocol and path)")
+	addr             = flag.String("addr", ":9999", "Listen address, either host:port or unix:/path/to/socket")
+	readTimeout      = flag.Duration("read-timeout", 0, "How long to wait for an agent-send payload from haproxy, set this when agent-send is configured (0 to answer right away without reading)")
+	writeTimeout     = flag.Duration("write-timeout", 5*time.Second, "Timeout for writing the answer to haproxy")
+	maxConns         = flag.Int("max-conns", 64, "Maximum number of concurrent agent connections")
+	allowList        = flag.String("allow", "", "Comma separated list of ips and networks allowed to connect (all if empty)")
+	shutdownGrace    = flag.Duration("shutdown-grace", 15*time.Second, "How long to answer drain after receiving SIGTERM before exiting")
+	rpcTimeout       = flag.Int("rpc-timeout", 10, "Timeout per rpc call")
+	maintPath        = flag.String("maintfile", "/etc/haproxy/maintenance", "A file which if exists puts this server in maintenance mode")
+	statusAddr       = flag.String("status-addr", "", "Listen address for the JSON status API (disabled if empty)")
+	statusHistory    = flag.Int("status-history", solanahc.DefaultHistorySize, "Number of evaluations kept for the status API history")
+	controlAddr      = flag.String("control-addr", "", "Listen address for the control API, either host:port or unix:/path/to/socket (disabled if empty)")
+	controlTokenFile = flag.String("control-token-file", "", "File containing the bearer token required by the control API (required unless listening on a unix socket)")
+	controlState     = flag.String("control-state", "", "File in which control API overrides are persisted across restarts")
+	controlAuditLog  = flag.String("control-audit-log", "", "File to which control API changes are appended (defaults to the standard log)")
+	peerList         = flag.String("peers", "", "Comma separated list of status APIs of other agents checking the same backend, e.g. http://lb2:9998")
+	peerQuorum       = flag.Int("peer-quorum", 0, "Number of agents, including this one, that have to agree before the backend is taken down (default a majority)")
+	peerTimeout      = flag.Duration("peer-timeout", 2*time.Second, "Timeout for polling a peer")
+	peerMaxAge       = flag.Duration("peer-max-age", 30*time.Second, "Ignore the observation of a peer that couldn't be polled for this long")
+	snapshotLog      = flag.String("snapshot-log", "", "File to which every evaluation with the node states is appended, for the what-if analyzer")
+	recordPath       = flag.String("record", "", "File to which all rpc requests and responses are appended, for replaying them with health-check-replay")
+	readyGrace       = flag.Duration("ready-grace", 30*time.Second, "How long to keep answering ready after leaving maintenance or drain")
+	checkFlags       = solanahc.RegisterCheckFlags(flag.CommandLine)
+	dampeningFlags   = solanahc.RegisterDampeningFlags(flag.CommandLine)
+	profilesPath     = flag.String("profiles", "", "JSON file with additional check profiles which can be selected with ?profile= or profile= in agent-send")
+	shadowProfile    = flag.String("shadow", "", "Name of a profile from -profiles evaluated in shadow mode, it never affects the answers but every disagreement with the live verdict is logged")
+	shadowLog        = flag.String("shadow-log", "", "File to which every evaluation where the shadow verdict differs from the live one is appended")
 )
 
 func main() {
 	flag.Parse()
 
-	var servers []string
-	if *REFERENCE_SERVERS != "" {
-		servers = strings.Split(*REFERENCE_SERVERS, ",")
-		for i := 0; i < len(servers); i++ {
-			servers[i] = strings.TrimSpace(servers[i])
-		}
-	}
+	servers := checkFlags.References()
+	config := checkFlags.Config()
 
 	log.Println("Listening on ", *addr, "testing rpc", *rpcURI)
 
@@ -49,63 +65,266 @@ func main() {
 	log.Println("Checks: ")
 	if len(servers) > 0 {
 		one_check_enabled = true
-		log.Println("+ Reference server comparison check: slots=", *MAX_SLOT_DIFF, "servers=", servers)
+		log.Println("+ Reference server comparison check: slots=", config.MaxSlotDiff, "servers=", servers)
+	} else {
+		log.Println("- Reference server comparison check disabled, running standalone.")
+	}
+
+	if len(servers) > 0 && config.GenesisCheck {
+		log.Println("+ Genesis hash check")
+	} else {
+		log.Println("- Genesis hash check disabled.")
+	}
+
+	if len(servers) > 0 && config.ForkCheck {
+		log.Println("+ Fork check")
+	} else {
+		log.Println("- Fork check disabled.")
+	}
+
+	if len(servers) > 0 && len(config.Accounts) > 0 {
+		log.Println("+ Account consistency check: ", config.Accounts)
+	} else {
+		log.Println("- Account consistency check disabled.")
+	}
+
+	if config.HealthCheck {
+		one_check_enabled = true
+		log.Println("+ Node health check")
+	} else {
+		log.Println("- Node health check disabled.")
+	}
+
+	if *checkFlags.MaxStallTime > 0 {
+		one_check_enabled = true
+		log.Println("+ Stall check: ", *checkFlags.MaxStallTime)
+	} else {
+		log.Println("- Stall check disabled.")
+	}
+
+	if *checkFlags.MaxBlockAge > 0 {
+		one_check_enabled = true
+		log.Println("+ Block time check: ", *checkFlags.MaxBlockAge)
+	} else {
+		log.Println("- Block time check disabled.")
+	}
+
+	if config.MaxProcessedGap > 0 {
+		one_check_enabled = true
+		log.Println("+ Processed slot gap check: ", config.MaxProcessedGap)
 	} else {
-		log.Println("- Reference server comparison check disabled.")
+		log.Println("- Processed slot gap check disabled.")
 	}
 
-	if *MAX_TRANSMIT_CHECK_ENABLED {
+	if config.RetransmitCheck {
 		one_check_enabled = true
-		log.Println("+ Max transmit check: ", *MAX_SLOT_DIFF)
+		log.Println("+ Max transmit check: ", config.MaxSlotDiff)
 	} else {
 		log.Println("- Max transmit check disabled..")
 	}
 
-	if *BLOCK_CHECK_ENABLED {
+	if config.BlockCheck {
 		one_check_enabled = true
-		log.Println("+ Block check: ", *MAX_BLOCK_DIFF)
+		log.Println("+ Block check: ", config.MaxBlockDiff)
 	} else {
 		log.Println("- Block check disabled.")
 	}
 
-	if *MINIMUM_LEDGER_SIZE > 0 {
+	if config.MinimumLedgerSize > 0 {
 		one_check_enabled = true
-		log.Println("+ Ledger size requirement: ", *MINIMUM_LEDGER_SIZE)
+		log.Println("+ Ledger size requirement: ", config.MinimumLedgerSize)
 	} else {
 		log.Println("- Ledger size requirement disabled.")
 	}
 
+	if *dampeningFlags.Enabled {
+		log.Println("+ Flap dampening: penalty=", *dampeningFlags.Penalty, "suppress=", *dampeningFlags.Suppress, "reuse=", *dampeningFlags.Reuse, "half-life=", *dampeningFlags.HalfLife)
+	} else {
+		log.Println("- Flap dampening disabled.")
+	}
+
 	if !one_check_enabled {
 		log.Println("WARNING: All checks are disabled. This will always return up.")
 	}
 
+	levels, fallback, err := checkFlags.Levels()
+	if err != nil {
+		log.Fatal("invalid -check-levels: ", err)
+	}
+	names := make([]string, 0, len(levels))
+	for name := range levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Println("check level: ", name, "severity=", levels[name].Severity, "fall=", levels[name].Fall, "rise=", levels[name].Rise)
+	}
+
+	profiles, err := solanahc.LoadProfiles(*profilesPath, config, levels, fallback)
+	if err != nil {
+		log.Fatal("couldn't load profiles: ", err)
+	}
+	// The shadow profile can't be selected by haproxy
+	shadow, ok := profiles[*shadowProfile]
+	if *shadowProfile != "" && !ok {
+		log.Fatal("unknown shadow profile ", *shadowProfile)
+	}
+	delete(profiles, *shadowProfile)
+	for name, p := range profiles {
+		log.Println("profile: ", name, fmt.Sprintf("%+v", p.Config))
+	}
+	if shadow != nil {
+		log.Println("shadow profile: ", shadow.Name, fmt.Sprintf("%+v", shadow.Config))
+	}
+
 	// Load initial state
-	health_state := NewHealthState(*rpcURI, servers)
-	go health_state.UpdateState(HEALTH_UPDATE_INTERVAL)
+	health_state := solanahc.NewHealthState(*rpcURI, config, levels, fallback)
+	health_state.Profiles = profiles
+	health_state.Shadow = shadow
+	health_state.HistorySize = *statusHistory
+	health_state.Dampener = dampeningFlags.Dampener()
 
-	server := tcp_server.New(*addr)
+	monitor := solanahc.NewMonitor([]*solanahc.HealthState{health_state}, servers)
+	if *recordPath != "" {
+		recorder, err := solanarpc.OpenRecorder(*recordPath, nil)
+		if err != nil {
+			log.Fatal("couldn't open recording: ", err)
+		}
+		monitor.Transport = recorder
+		log.Println("+ Recording rpc traffic to ", *recordPath)
+	}
+	if *snapshotLog != "" {
+		logSnapshots(monitor, health_state, *snapshotLog)
+	}
+	if shadow != nil {
+		logShadow(monitor, health_state, *shadowLog)
+	}
+	go monitor.Run(HEALTH_UPDATE_INTERVAL)
+
+	var peers *Peers
+	if *peerList != "" {
+		name, _ := os.Hostname()
+		peers = NewPeers(name, solanahc.SplitList(*peerList), *peerQuorum, *peerTimeout, *peerMaxAge, health_state)
+		log.Println("+ Peer consensus: peers=", *peerList, "quorum=", peers.quorum)
+		if *statusAddr == "" {
+			log.Println("WARNING: -peers without -status-addr, the peers can't poll this agent")
+		}
+		go peers.Run(HEALTH_UPDATE_INTERVAL)
+	}
 
-	var maintenance_mode uint32 = 0
+	var control *Control
+	if *controlAddr != "" {
+		control = newControl(health_state)
+		go func() {
+			log.Fatal("control api error ", control.ListenAndServe(*controlAddr))
+		}()
+	}
 
-	server.OnNewClient(func(c *tcp_server.Client) {
-		defer c.Close()
-		// Set the server to maintenance mode
-		if _, err := os.Stat(*maintPath); err == nil {
-			atomic.StoreUint32(&maintenance_mode, 1)
-			c.Send("maint\n")
-			return
-		} else if atomic.LoadUint32(&maintenance_mode) == 1 {
-			atomic.StoreUint32(&maintenance_mode, 0)
-			c.Send("ready\n")
-			return
+	responder := NewResponder(health_state, control, peers, *maintPath, *readyGrace)
+
+	if *statusAddr != "" {
+		statusServer := NewStatusServer(health_state, append([]string{*rpcURI}, servers...))
+		statusServer.Peers = peers
+		statusServer.Responder = responder
+		go statusServer.ListenAndServe(*statusAddr)
+	}
+
+	allow, err := ParseAllowList(*allowList)
+	if err != nil {
+		log.Fatal("invalid -allow: ", err)
+	}
+
+	listener, err := listen(*addr)
+	if err != nil {
+		log.Fatal("listen error: ", err)
+	}
+
+	server := NewAgentServer(responder, *readTimeout, *writeTimeout, *maxConns, allow)
+
+	// Keep answering drain for a while on shutdown so haproxy moves connections away
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Println("received ", sig)
+		server.Shutdown(*shutdownGrace)
+	}()
+
+	if err := server.Serve(listener); err != nil {
+		log.Fatal("serve error: ", err)
+	}
+	log.Println("stopped")
+}
+
+func newControl(health_state *solanahc.HealthState) *Control {
+	var token string
+	if *controlTokenFile != "" {
+		data, err := ioutil.ReadFile(*controlTokenFile)
+		if err != nil {
+			log.Fatal("couldn't read control token ", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	if err := checkControlAuth(*controlAddr, token); err != nil {
+		log.Fatal(err)
+	}
+
+	audit := log.New(os.Stderr, "audit: ", log.LstdFlags)
+	if *controlAuditLog != "" {
+		f, err := os.OpenFile(*controlAuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			log.Fatal("couldn't open audit log ", err)
 		}
+		audit = log.New(f, "", log.LstdFlags)
+	}
 
-		status := health_state.GetStatus()
-		log.Println("answering health request node is: ", status)
-		c.Send(status + "\n")
+	control, err := NewControl([]string{health_state.RpcUri}, token, *controlState, audit)
+	if err != nil {
+		log.Fatal("couldn't load control state ", err)
+	}
+	return control
+}
 
-		return
+// Appends the evaluation after every check as a line of JSON
+func logSnapshots(monitor *solanahc.Monitor, health_state *solanahc.HealthState, path string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatal("couldn't open snapshot log ", err)
+	}
+	encoder := json.NewEncoder(f)
+	monitor.OnEvaluated(func() {
+		if eval, ok := health_state.LastEvaluation(); ok {
+			if err := encoder.Encode(eval); err != nil {
+				log.Println("couldn't write snapshot log ", err)
+			}
+		}
 	})
+	log.Println("+ Logging snapshots to ", path)
+}
+
+// Logs every evaluation where the shadow verdict differs from the live one, and appends it to path if set
+func logShadow(monitor *solanahc.Monitor, health_state *solanahc.HealthState, path string) {
+	var encoder *json.Encoder
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal("couldn't open shadow log ", err)
+		}
+		encoder = json.NewEncoder(f)
+		log.Println("+ Logging shadow disagreements to ", path)
+	}
 
-	server.Listen()
+	monitor.OnEvaluated(func() {
+		eval, ok := health_state.LastEvaluation()
+		if !ok || !eval.ShadowDiffers {
+			return
+		}
+		log.Println("shadow verdict differs: live=", eval.Status, " shadow=", eval.Shadow)
+		if encoder != nil {
+			if err := encoder.Encode(eval); err != nil {
+				log.Println("couldn't write shadow log ", err)
+			}
+		}
+	})
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// Exposes the state of the agent itself, the node metrics are provided by health-check-exporter
+type AgentCollector struct {
+	healthState      *solanahc.HealthState
+	upDesc           *prometheus.Desc
+	checkActiveDesc  *prometheus.Desc
+	checkFailsDesc   *prometheus.Desc
+	checkSkipsDesc   *prometheus.Desc
+	loadFailuresDesc *prometheus.Desc
+	penaltyDesc      *prometheus.Desc
+	dampenedDesc     *prometheus.Desc
+	flapsDesc        *prometheus.Desc
+	shadowUpDesc     *prometheus.Desc
+	shadowDiffsDesc  *prometheus.Desc
+}
+
+func NewAgentCollector(healthState *solanahc.HealthState) *AgentCollector {
+	return &AgentCollector{
+		healthState: healthState,
+		upDesc: prometheus.NewDesc(
+			"solana_health_check_up",
+			"Whether the agent reports the node as up",
+			[]string{"rpc"}, nil),
+		checkActiveDesc: prometheus.NewDesc(
+			"solana_health_check_check_active",
+			"Whether a check currently counts towards the verdict",
+			[]string{"rpc", "check", "severity"}, nil),
+		checkFailsDesc: prometheus.NewDesc(
+			"solana_health_check_check_failures",
+			"Number of consecutive failures of a check",
+			[]string{"rpc", "check"}, nil),
+		checkSkipsDesc: prometheus.NewDesc(
+			"solana_health_check_check_skipped_total",
+			"Number of rounds in which a check couldn't be evaluated, e.g. accounts without a common slot",
+			[]string{"rpc", "check"}, nil),
+		loadFailuresDesc: prometheus.NewDesc(
+			"solana_health_check_load_failures",
+			"Number of consecutive failures to load the node states",
+			[]string{"rpc"}, nil),
+		penaltyDesc: prometheus.NewDesc(
+			"solana_health_check_dampening_penalty",
+			"The current flap dampening penalty",
+			[]string{"rpc"}, nil),
+		dampenedDesc: prometheus.NewDesc(
+			"solana_health_check_dampened",
+			"Whether the node is held down by flap dampening",
+			[]string{"rpc"}, nil),
+		flapsDesc: prometheus.NewDesc(
+			"solana_health_check_flaps",
+			"Number of status transitions within the flap window",
+			[]string{"rpc"}, nil),
+		shadowUpDesc: prometheus.NewDesc(
+			"solana_health_check_shadow_up",
+			"Whether the shadow profile reports the node as up",
+			[]string{"rpc", "profile"}, nil),
+		shadowDiffsDesc: prometheus.NewDesc(
+			"solana_health_check_shadow_disagreements_total",
+			"Number of evaluations where the shadow status differed from the live one",
+			[]string{"rpc", "profile"}, nil),
+	}
+}
+
+func (c *AgentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.upDesc
+	ch <- c.checkActiveDesc
+	ch <- c.checkFailsDesc
+	ch <- c.checkSkipsDesc
+	ch <- c.loadFailuresDesc
+	ch <- c.penaltyDesc
+	ch <- c.dampenedDesc
+	ch <- c.flapsDesc
+	ch <- c.shadowUpDesc
+	ch <- c.shadowDiffsDesc
+}
+
+func (c *AgentCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.healthState
+
+	var up float64
+	if status, _ := s.GetVerdict(); status == solanahc.StatusUp {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, up, s.RpcUri)
+
+	for _, cs := range s.CheckStates() {
+		var active float64
+		if cs.Active {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.checkActiveDesc, prometheus.GaugeValue, active, s.RpcUri, cs.Name, cs.Severity.String())
+		ch <- prometheus.MustNewConstMetric(c.checkFailsDesc, prometheus.GaugeValue, float64(cs.Failures), s.RpcUri, cs.Name)
+		ch <- prometheus.MustNewConstMetric(c.checkSkipsDesc, prometheus.CounterValue, float64(cs.Skipped), s.RpcUri, cs.Name)
+	}
+	ch <- prometheus.MustNewConstMetric(c.loadFailuresDesc, prometheus.GaugeValue, float64(s.LoadFailures()), s.RpcUri)
+
+	if d, ok := s.DampeningState(); ok {
+		var dampened float64
+		if d.Suppressed {
+			dampened = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.penaltyDesc, prometheus.GaugeValue, d.Penalty, s.RpcUri)
+		ch <- prometheus.MustNewConstMetric(c.dampenedDesc, prometheus.GaugeValue, dampened, s.RpcUri)
+		ch <- prometheus.MustNewConstMetric(c.flapsDesc, prometheus.GaugeValue, float64(d.Flaps), s.RpcUri)
+	}
+
+	if status, _, ok := s.GetShadowVerdict(); ok {
+		var shadowUp float64
+		if status == solanahc.StatusUp {
+			shadowUp = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.shadowUpDesc, prometheus.GaugeValue, shadowUp, s.RpcUri, s.Shadow.Name)
+		ch <- prometheus.MustNewConstMetric(c.shadowDiffsDesc, prometheus.CounterValue, float64(s.ShadowDisagreements()), s.RpcUri, s.Shadow.Name)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// What an agent itself thinks of its backend, exchanged between peers on /peer
+type PeerObservation struct {
+	Agent   string          `json:"agent"`
+	Backend string          `json:"backend"`
+	Status  solanahc.Status `json:"status"`
+	Reason  string          `json:"reason,omitempty"`
+	Time    time.Time       `json:"time"`
+}
+
+// Polls the observations of the other agents checking the same backend, a backend
+// is only taken down when a quorum of agents agrees
+type Peers struct {
+	name        string
+	urls        []string
+	quorum      int
+	maxAge      time.Duration
+	client      *http.Client
+	healthState *solanahc.HealthState
+
+	mu           sync.RWMutex
+	observations map[string]PeerObservation
+}
+
+// A quorum of 0 requires a majority of all agents
+func NewPeers(name string, urls []string, quorum int, timeout time.Duration, maxAge time.Duration, healthState *solanahc.HealthState) *Peers {
+	if quorum <= 0 {
+		quorum = (len(urls)+1)/2 + 1
+	}
+	for i := range urls {
+		urls[i] = strings.TrimRight(urls[i], "/")
+	}
+	return &Peers{
+		name:         name,
+		urls:         urls,
+		quorum:       quorum,
+		maxAge:       maxAge,
+		client:       &http.Client{Timeout: timeout},
+		healthState:  healthState,
+		observations: map[string]PeerObservation{},
+	}
+}
+
+func (p *Peers) Local() PeerObservation {
+	status, reason := p.healthState.GetVerdict()
+	return PeerObservation{
+		Agent:   p.name,
+		Backend: p.healthState.RpcUri,
+		Status:  status,
+		Reason:  reason,
+		Time:    time.Now(),
+	}
+}
+
+func (p *Peers) fetch(url string) (observation PeerObservation, err error) {
+	resp, err := p.client.Get(url + "/peer")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("peer returned %s", resp.Status)
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(&observation)
+	return
+}
+
+// Polls every peer once, unreachable peers keep their last observation until it expires
+func (p *Peers) Poll() {
+	var wg sync.WaitGroup
+	for _, url := range p.urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			observation, err := p.fetch(url)
+			if err != nil {
+				log.Println("error polling peer ", url, " ", err)
+				return
+			}
+			if observation.Backend != p.healthState.RpcUri {
+				log.Println("peer ", url, " checks a different backend ", observation.Backend)
+				return
+			}
+			// Use our own clock, the peer's may be off
+			observation.Time = time.Now()
+
+			p.mu.Lock()
+			p.observations[url] = observation
+			p.mu.Unlock()
+		}(url)
+	}
+	wg.Wait()
+}
+
+func (p *Peers) Run(schedule time.Duration) {
+	ticker := time.NewTicker(schedule)
+
+	for {
+		p.Poll()
+		<-ticker.C
+	}
+}
+
+// Returns the observations which haven't expired yet
+func (p *Peers) Observations() (observations []PeerObservation) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	for _, url := range p.urls {
+		if o, ok := p.observations[url]; ok && now.Sub(o.Time) <= p.maxAge {
+			observations = append(observations, o)
+		}
+	}
+	return
+}
+
+// Applies the quorum to the local verdict. Without any reachable peer the local
+// verdict stands, when the peers disagree "peerdisagree" is added to the reason.
+func (p *Peers) Consensus(status solanahc.Status, reason string) (solanahc.Status, string) {
+	observations := p.Observations()
+	if len(observations) == 0 {
+		return status, reason
+	}
+
+	down := 0
+	if status == solanahc.StatusDown {
+		down++
+	}
+	disagree := false
+	for _, o := range observations {
+		if o.Status == solanahc.StatusDown {
+			down++
+		}
+		if (o.Status == solanahc.StatusDown) != (status == solanahc.StatusDown) {
+			disagree = true
+		}
+	}
+
+	if disagree {
+		reason = joinReason("peerdisagree", reason)
+	}
+	// Agents that can't be reached don't count towards the quorum
+	quorum := p.quorum
+	if quorum > len(observations)+1 {
+		quorum = len(observations) + 1
+	}
+	if status == solanahc.StatusDown && down < quorum {
+		log.Println("no quorum for down, ", down, " of ", quorum, " agents agree")
+		return solanahc.StatusUp, joinReason(reason, fmt.Sprintf("quorum=%d/%d", down, quorum))
+	}
+	return status, reason
+}
+
+func joinReason(a string, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "," + b
+}
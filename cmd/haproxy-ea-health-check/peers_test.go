@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+func TestPeersQuorum(t *testing.T) {
+	up, down, drain := solanahc.StatusUp, solanahc.StatusDown, solanahc.StatusDrain
+	tests := []struct {
+		name    string
+		local   solanahc.Status
+		peers   []solanahc.Status
+		quorum  int
+		status  solanahc.Status
+		reasons string
+	}{
+		{name: "no peers", local: down, status: down, reasons: "behind"},
+		{name: "all up", local: up, peers: []solanahc.Status{up, up}, status: up},
+		{name: "all down", local: down, peers: []solanahc.Status{down, down}, status: down, reasons: "behind"},
+		{name: "majority down", local: down, peers: []solanahc.Status{down, up}, status: down, reasons: "peerdisagree,behind"},
+		{name: "majority up", local: down, peers: []solanahc.Status{up, up}, status: up, reasons: "peerdisagree,behind,quorum=1/2"},
+		{name: "up while a peer is down", local: up, peers: []solanahc.Status{down, up}, status: up, reasons: "peerdisagree"},
+		{name: "drain isn't down", local: down, peers: []solanahc.Status{drain, drain}, status: up, reasons: "peerdisagree,behind,quorum=1/2"},
+		{name: "quorum of one", local: down, peers: []solanahc.Status{up, up}, quorum: 1, status: down, reasons: "peerdisagree,behind"},
+		{name: "quorum of all", local: down, peers: []solanahc.Status{down, up}, quorum: 3, status: up, reasons: "peerdisagree,behind,quorum=2/3"},
+		{name: "quorum above the agents", local: down, peers: []solanahc.Status{down}, quorum: 5, status: down, reasons: "behind"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			urls := []string{}
+			for _, status := range test.peers {
+				urls = append(urls, newTestPeer(t, status))
+			}
+			peers := NewPeers("lb1", urls, test.quorum, time.Second, time.Minute, newTestHealthState(t, solanahc.StatusUp))
+			peers.Poll()
+
+			reason := ""
+			if test.local == solanahc.StatusDown {
+				reason = "behind"
+			}
+			status, reasons := peers.Consensus(test.local, reason)
+			if status != test.status || reasons != test.reasons {
+				t.Errorf("got %s #%s, want %s #%s", status, reasons, test.status, test.reasons)
+			}
+		})
+	}
+}
+
+// Expired observations and peers that can't be reached don't count towards the quorum
+func TestPeersStaleAndUnreachable(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, PeerObservation{Agent: "other", Backend: "http://other:8899", Status: solanahc.StatusUp})
+	}))
+	defer other.Close()
+	stale := newTestPeer(t, solanahc.StatusUp)
+	fresh := newTestPeer(t, solanahc.StatusUp)
+
+	tests := []struct {
+		name    string
+		urls    []string
+		status  solanahc.Status
+		reasons string
+	}{
+		{name: "unreachable", urls: []string{unreachable.URL, failing.URL}, status: solanahc.StatusDown, reasons: "behind"},
+		{name: "different backend", urls: []string{other.URL}, status: solanahc.StatusDown, reasons: "behind"},
+		{name: "stale", urls: []string{stale}, status: solanahc.StatusDown, reasons: "behind"},
+		{name: "fresh with unreachable and stale", urls: []string{unreachable.URL, stale, fresh}, status: solanahc.StatusUp, reasons: "peerdisagree,behind,quorum=1/2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			peers := NewPeers("lb1", test.urls, 0, time.Second, time.Minute, newTestHealthState(t, solanahc.StatusUp))
+			peers.Poll()
+
+			// The stale peer answered once, long ago
+			peers.mu.Lock()
+			if o, ok := peers.observations[stale]; ok {
+				o.Time = time.Now().Add(-2 * time.Minute)
+				peers.observations[stale] = o
+			}
+			peers.mu.Unlock()
+
+			status, reasons := peers.Consensus(solanahc.StatusDown, "behind")
+			if status != test.status || reasons != test.reasons {
+				t.Errorf("got %s #%s, want %s #%s", status, reasons, test.status, test.reasons)
+			}
+		})
+	}
+}
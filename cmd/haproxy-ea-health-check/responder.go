@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// Builds the agent-check answer from the maintenance file, the control overrides and the health state
+type Responder struct {
+	healthState *solanahc.HealthState
+	control     *Control
+	peers       *Peers
+	maintPath   string
+	readyGrace  time.Duration
+
+	mu         sync.Mutex
+	admin      bool
+	readyUntil time.Time
+}
+
+func NewResponder(healthState *solanahc.HealthState, control *Control, peers *Peers, maintPath string, readyGrace time.Duration) *Responder {
+	return &Responder{
+		healthState: healthState,
+		control:     control,
+		peers:       peers,
+		maintPath:   maintPath,
+		readyGrace:  readyGrace,
+	}
+}
+
+func (r *Responder) Answer(req AgentRequest) (answer string) {
+	// This agent only checks a single backend
+	if req.Backend != "" && req.Backend != r.healthState.RpcUri {
+		return solanahc.FormatStatus(solanahc.StatusDown, "unknownbackend")
+	}
+
+	admin, status := r.evaluate(req.Params["profile"])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.answer(admin, status, time.Now(), true)
+}
+
+// Returns the answer haproxy currently gets for the default profile, without it counting as a check
+func (r *Responder) Current() string {
+	admin, status := r.evaluate("")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.answer(admin, status, time.Now(), false)
+}
+
+// Combines the administrative state and the status into the answer, must be called with mu held.
+// Only an answer that is sent to haproxy starts or ends the ready period.
+func (r *Responder) answer(admin string, status string, now time.Time, sent bool) string {
+	if admin != "" {
+		if sent {
+			r.admin = true
+			r.readyUntil = time.Time{}
+		}
+		if admin == string(OverrideDrain) {
+			return admin + " " + status
+		}
+		return admin
+	}
+
+	// Leaving maintenance or drain has to be announced with "ready", keep sending it
+	// for a while so a single lost connection doesn't leave the server in maintenance
+	readyUntil := r.readyUntil
+	if r.admin {
+		readyUntil = now.Add(r.readyGrace)
+		if sent {
+			r.admin = false
+			r.readyUntil = readyUntil
+		}
+	}
+	if now.Before(readyUntil) {
+		return "ready " + status
+	}
+	return status
+}
+
+// Returns the administrative state (maint, drain or empty) and the operational status
+func (r *Responder) evaluate(profile string) (admin string, status string) {
+	if _, err := os.Stat(r.maintPath); err == nil {
+		return string(OverrideMaint), ""
+	}
+
+	if r.control != nil {
+		if o, ok := r.control.Get(r.healthState.RpcUri); ok {
+			log.Println("override active: ", o.Mode, o.Reason)
+			switch o.Mode {
+			case OverrideMaint:
+				return string(OverrideMaint), ""
+			case OverrideDrain:
+				admin = string(OverrideDrain)
+			case OverrideForceUp:
+				return "", string(solanahc.StatusUp) + " #forced"
+			case OverrideForceDown:
+				return "", string(solanahc.StatusDown) + " #forced"
+			}
+		}
+	}
+
+	verdict, reason := r.healthState.GetVerdict()
+	if profile != "" {
+		var ok bool
+		if verdict, reason, ok = r.healthState.GetProfileVerdict(profile); !ok {
+			return "", solanahc.FormatStatus(solanahc.StatusDown, "unknownprofile")
+		}
+	}
+
+	// Another agent may not share our view, e.g. when our own network is the problem
+	if r.peers != nil {
+		verdict, reason = r.peers.Consensus(verdict, reason)
+	}
+
+	// Checks with drain severity drain the node while keeping it up
+	if verdict == solanahc.StatusDrain {
+		admin = string(OverrideDrain)
+		verdict = solanahc.StatusUp
+	}
+
+	status = solanahc.FormatStatus(verdict, reason)
+	return
+}
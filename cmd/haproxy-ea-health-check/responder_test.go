@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// Returns a health state for testBackend with the given verdict, holes in the blocks drain the node
+func newTestHealthState(t *testing.T, status solanahc.Status) *solanahc.HealthState {
+	levels := solanahc.DefaultCheckLevels(1, 1)
+	levels[solanahc.CheckBlocks] = solanahc.CheckLevel{Severity: solanahc.SeverityDrain, Rise: 1, Fall: 1}
+	fallback := solanahc.CheckLevel{Severity: solanahc.SeverityDown, Rise: 1, Fall: 1}
+	state := solanahc.NewHealthState(testBackend, solanahc.CheckConfig{}, levels, fallback)
+
+	results := []solanahc.CheckResult{
+		solanahc.NewCheckResult(solanahc.CheckBehind, 0, 0, 0, ""),
+		solanahc.NewCheckResult(solanahc.CheckBlocks, 0, 0, 0, ""),
+	}
+	switch status {
+	case solanahc.StatusDown:
+		results[0] = solanahc.NewCheckResult(solanahc.CheckBehind, 1000, 0, 200, "behind")
+	case solanahc.StatusDrain:
+		results[1] = solanahc.NewCheckResult(solanahc.CheckBlocks, 0, 0, 0, "holes")
+	}
+	state.RegisterResults(results)
+	if verdict, _ := state.GetVerdict(); verdict != status {
+		t.Fatalf("health state is %s, want %s", verdict, status)
+	}
+	return state
+}
+
+// Serves the observation of another agent on /peer
+func newTestPeer(t *testing.T, status solanahc.Status) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, PeerObservation{Agent: "peer", Backend: testBackend, Status: status})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestResponderPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		maint    bool
+		override OverrideMode
+		verdict  solanahc.Status
+		peers    []solanahc.Status
+		answer   string
+	}{
+		{name: "up", verdict: solanahc.StatusUp, answer: "up"},
+		{name: "down", verdict: solanahc.StatusDown, answer: "down #behind"},
+		{name: "drain severity", verdict: solanahc.StatusDrain, answer: "drain up #holes"},
+		{name: "maint file over force-up", maint: true, override: OverrideForceUp, verdict: solanahc.StatusUp, answer: "maint"},
+		{name: "maint file over drain", maint: true, override: OverrideDrain, verdict: solanahc.StatusDrain, answer: "maint"},
+		{name: "maint override over drain severity", override: OverrideMaint, verdict: solanahc.StatusDrain, answer: "maint"},
+		{name: "drain override keeps the verdict", override: OverrideDrain, verdict: solanahc.StatusDown, answer: "drain down #behind"},
+		{name: "force-up over down", override: OverrideForceUp, verdict: solanahc.StatusDown, answer: "up #forced"},
+		{name: "force-down over up", override: OverrideForceDown, verdict: solanahc.StatusUp, answer: "down #forced"},
+		{name: "force-down over peers", override: OverrideForceDown, verdict: solanahc.StatusUp, peers: []solanahc.Status{solanahc.StatusUp, solanahc.StatusUp}, answer: "down #forced"},
+		{name: "no quorum for down", verdict: solanahc.StatusDown, peers: []solanahc.Status{solanahc.StatusUp, solanahc.StatusUp}, answer: "up #peerdisagree,behind,quorum=1/2"},
+		{name: "quorum for down", verdict: solanahc.StatusDown, peers: []solanahc.Status{solanahc.StatusDown, solanahc.StatusUp}, answer: "down #peerdisagree,behind"},
+		{name: "drain override with no quorum", override: OverrideDrain, verdict: solanahc.StatusDown, peers: []solanahc.Status{solanahc.StatusUp, solanahc.StatusUp}, answer: "drain up #peerdisagree,behind,quorum=1/2"},
+		{name: "peers can't take down a drained node", verdict: solanahc.StatusDrain, peers: []solanahc.Status{solanahc.StatusDown, solanahc.StatusDown}, answer: "drain up #peerdisagree,holes"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maintPath := filepath.Join(t.TempDir(), "maintenance")
+			if test.maint {
+				if err := ioutil.WriteFile(maintPath, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			control, _ := newTestControl(t, "", "")
+			if test.override != "" {
+				control.Set(Override{Backend: testBackend, Mode: test.override, Created: time.Now()}, "test")
+			}
+			state := newTestHealthState(t, test.verdict)
+
+			var peers *Peers
+			if len(test.peers) > 0 {
+				urls := []string{}
+				for _, status := range test.peers {
+					urls = append(urls, newTestPeer(t, status))
+				}
+				peers = NewPeers("lb1", urls, 0, time.Second, time.Minute, state)
+				peers.Poll()
+			}
+
+			responder := NewResponder(state, control, peers, maintPath, 0)
+			if answer := responder.Answer(AgentRequest{}); answer != test.answer {
+				t.Errorf("got %q, want %q", answer, test.answer)
+			}
+		})
+	}
+}
+
+func TestResponderUnknownBackend(t *testing.T) {
+	responder := NewResponder(newTestHealthState(t, solanahc.StatusUp), nil, nil, filepath.Join(t.TempDir(), "maintenance"), 0)
+	if answer := responder.Answer(AgentRequest{Backend: "http://other:8899"}); answer != "down #unknownbackend" {
+		t.Errorf("got %q for another backend", answer)
+	}
+	if answer := responder.Answer(AgentRequest{Params: map[string]string{"profile": "strict"}}); answer != "down #unknownprofile" {
+		t.Errorf("got %q for an unknown profile", answer)
+	}
+}
+
+// Leaving maintenance is announced with ready until the grace period is over
+func TestResponderReady(t *testing.T) {
+	control, _ := newTestControl(t, "", "")
+	responder := NewResponder(newTestHealthState(t, solanahc.StatusUp), control, nil, filepath.Join(t.TempDir(), "maintenance"), time.Hour)
+
+	answers := []string{}
+	answers = append(answers, responder.Answer(AgentRequest{}))
+	control.Set(Override{Backend: testBackend, Mode: OverrideMaint, Created: time.Now()}, "test")
+	answers = append(answers, responder.Answer(AgentRequest{}))
+	control.Clear(testBackend, "test")
+	answers = append(answers, responder.Answer(AgentRequest{}), responder.Answer(AgentRequest{}))
+
+	want := []string{"up", "maint", "ready up", "ready up"}
+	for i := range want {
+		if answers[i] != want[i] {
+			t.Errorf("answer %d is %q, want %q", i, answers[i], want[i])
+		}
+	}
+
+	responder.readyGrace = 0
+	control.Set(Override{Backend: testBackend, Mode: OverrideMaint, Created: time.Now()}, "test")
+	responder.Answer(AgentRequest{})
+	control.Clear(testBackend, "test")
+	if answer := responder.Answer(AgentRequest{}); answer != "up" {
+		t.Errorf("got %q after the grace period, want up", answer)
+	}
+}
+
+// /status returns what haproxy is told and the verdict of the checks separately
+func TestStatusAnswer(t *testing.T) {
+	control, _ := newTestControl(t, "", "")
+	state := newTestHealthState(t, solanahc.StatusDrain)
+	statusServer := NewStatusServer(state, []string{"node"})
+	statusServer.Responder = NewResponder(state, control, nil, filepath.Join(t.TempDir(), "maintenance"), time.Hour)
+	server := httptest.NewServer(statusServer.Handler())
+	defer server.Close()
+
+	get := func() (status solanahc.AgentStatus) {
+		resp, err := server.Client().Get(server.URL + "/status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if status := get(); status.Status != "drain up #holes" || status.Verdict != "drain #holes" {
+		t.Errorf("got answer %q and verdict %q", status.Status, status.Verdict)
+	}
+	control.Set(Override{Backend: testBackend, Mode: OverrideMaint, Created: time.Now()}, "test")
+	if status := get(); status.Status != "maint" || status.Verdict != "drain #holes" {
+		t.Errorf("got answer %q and verdict %q in maintenance", status.Status, status.Verdict)
+	}
+
+	// Looking at the status doesn't start the ready grace period, only answering haproxy does
+	control.Clear(testBackend, "test")
+	if status := get(); status.Status != "drain up #holes" {
+		t.Errorf("got answer %q after maintenance without asking haproxy", status.Status)
+	}
+}
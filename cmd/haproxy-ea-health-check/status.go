@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+type ProbeResponse struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons"`
+	Profile string   `json:"profile,omitempty"`
+}
+
+type StatusServer struct {
+	healthState *solanahc.HealthState
+	servers     []string
+	registry    *prometheus.Registry
+	// Serves /peer when set
+	Peers *Peers
+	// Answers /status with what haproxy is told when set, rather than with the verdict alone
+	Responder *Responder
+}
+
+func NewStatusServer(healthState *solanahc.HealthState, servers []string) *StatusServer {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewAgentCollector(healthState))
+
+	return &StatusServer{
+		healthState: healthState,
+		servers:     servers,
+		registry:    registry,
+	}
+}
+
+func (ss *StatusServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", ss.handleStatus)
+	mux.HandleFunc("/history", ss.handleHistory)
+	mux.HandleFunc("/ready", ss.handleReady)
+	mux.HandleFunc("/live", ss.handleLive)
+	mux.Handle("/metrics", promhttp.HandlerFor(ss.registry, promhttp.HandlerOpts{}))
+	if ss.Peers != nil {
+		mux.HandleFunc("/peer", ss.handlePeer)
+	}
+	return mux
+}
+
+// Returns the current answer, the verdict and the evaluation that led to it
+func (ss *StatusServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	verdict := ss.healthState.GetStatus()
+	response := solanahc.AgentStatus{
+		RpcUri:  ss.healthState.RpcUri,
+		Servers: ss.servers,
+		Status:  verdict,
+		Verdict: verdict,
+	}
+	if ss.Responder != nil {
+		response.Status = ss.Responder.Current()
+	}
+	if eval, ok := ss.healthState.LastEvaluation(); ok {
+		response.Evaluation = &eval
+	}
+	if status, reason, ok := ss.healthState.GetShadowVerdict(); ok {
+		response.Shadow = solanahc.FormatStatus(status, reason)
+		response.ShadowDisagreements = ss.healthState.ShadowDisagreements()
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Returns the last n evaluations, oldest first (?n=10)
+func (ss *StatusServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	n := 0
+	if param := r.URL.Query().Get("n"); param != "" {
+		var err error
+		n, err = strconv.Atoi(param)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid value for n", http.StatusBadRequest)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, ss.healthState.History(n))
+}
+
+// Returns 200 if the node should receive traffic, 503 otherwise (?profile=name)
+func (ss *StatusServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	profile := r.URL.Query().Get("profile")
+
+	var status solanahc.Status
+	var reason string
+	if profile == "" {
+		status, reason = ss.healthState.GetVerdict()
+	} else {
+		var ok bool
+		status, reason, ok = ss.healthState.GetProfileVerdict(profile)
+		if !ok {
+			http.Error(w, "unknown profile", http.StatusNotFound)
+			return
+		}
+	}
+
+	code := http.StatusOK
+	if status != solanahc.StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, ProbeResponse{Status: string(status), Reasons: splitReason(reason), Profile: profile})
+}
+
+// Returns 200 as long as the node can be reached, even when it isn't ready
+func (ss *StatusServer) handleLive(w http.ResponseWriter, r *http.Request) {
+	alive, reason := ss.healthState.IsAlive()
+
+	code := http.StatusOK
+	status := "alive"
+	if !alive {
+		code = http.StatusServiceUnavailable
+		status = "dead"
+	}
+	writeJSON(w, code, ProbeResponse{Status: status, Reasons: splitReason(reason)})
+}
+
+// Returns the local verdict, before the peer consensus, to the other agents
+func (ss *StatusServer) handlePeer(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ss.Peers.Local())
+}
+
+func splitReason(reason string) []string {
+	if reason == "" {
+		return []string{}
+	}
+	return strings.Split(reason, ",")
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("error writing response ", err)
+	}
+}
+
+func (ss *StatusServer) ListenAndServe(addr string) {
+	log.Println("status api listening on ", addr)
+	err := http.ListenAndServe(addr, ss.Handler())
+	if err != nil {
+		log.Println("status api error ", err)
+	}
+}
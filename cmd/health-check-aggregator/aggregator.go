@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+// A haproxy agent with its status API
+type Agent struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+// The last poll of an agent
+type AgentState struct {
+	Agent
+	Reachable bool                  `json:"reachable"`
+	Error     string                `json:"error,omitempty"`
+	LastSeen  time.Time             `json:"lastSeen"`
+	Status    *solanahc.AgentStatus `json:"-"`
+}
+
+// What a single agent thinks of a node
+type AgentView struct {
+	Agent string `json:"agent"`
+	// What haproxy makes of the answer of the agent: up, down, drain or maint
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	// The answer of the agent and the verdict of its health checks alone
+	Answer  string         `json:"answer"`
+	Verdict string         `json:"verdict,omitempty"`
+	Slot    solanarpc.Slot `json:"slot"`
+	Updated time.Time      `json:"updated"`
+}
+
+// The views of every agent monitoring a node
+type NodeView struct {
+	RpcUri       string         `json:"rpc"`
+	Identity     string         `json:"identity,omitempty"`
+	Views        []AgentView    `json:"views"`
+	Up           int            `json:"up"`
+	Down         int            `json:"down"`
+	Drain        int            `json:"drain"`
+	Maint        int            `json:"maint"`
+	Disagreement bool           `json:"disagreement"`
+	Slot         solanarpc.Slot `json:"slot"`
+	Behind       int64          `json:"behind"`
+}
+
+// The pool wide view of all nodes
+type PoolView struct {
+	Time          time.Time      `json:"time"`
+	Tip           solanarpc.Slot `json:"tip"`
+	TipNode       string         `json:"tipNode,omitempty"`
+	Agents        []AgentState   `json:"agents"`
+	Nodes         []NodeView     `json:"nodes"`
+	Disagreements []string       `json:"disagreements"`
+}
+
+// Polls the status API of many agents and combines their views
+type Aggregator struct {
+	agents []Agent
+	client *http.Client
+	maxAge time.Duration
+
+	mu    sync.RWMutex
+	state map[string]AgentState
+	view  PoolView
+}
+
+func NewAggregator(agents []Agent, timeout time.Duration, maxAge time.Duration) *Aggregator {
+	a := &Aggregator{
+		agents: agents,
+		client: &http.Client{Timeout: timeout},
+		maxAge: maxAge,
+		state:  map[string]AgentState{},
+	}
+	a.view = a.aggregate(time.Now())
+	return a
+}
+
+// Parses a comma separated list of name=url, the name defaults to the url
+func ParseAgents(list string) (agents []Agent, err error) {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		agent := Agent{Name: entry, Url: entry}
+		if i := strings.Index(entry, "="); i > 0 && !strings.Contains(entry[:i], "://") {
+			agent = Agent{Name: entry[:i], Url: entry[i+1:]}
+		}
+		if !strings.Contains(agent.Url, "://") {
+			return nil, fmt.Errorf("invalid agent url %q", agent.Url)
+		}
+		agent.Url = strings.TrimRight(agent.Url, "/")
+		agents = append(agents, agent)
+	}
+	return
+}
+
+func (a *Aggregator) fetch(agent Agent) (status solanahc.AgentStatus, err error) {
+	resp, err := a.client.Get(agent.Url + "/status")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("agent returned %s", resp.Status)
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	return
+}
+
+// Polls every agent once and rebuilds the pool view
+func (a *Aggregator) Poll() {
+	var wg sync.WaitGroup
+	results := make(chan AgentState, len(a.agents))
+
+	for _, agent := range a.agents {
+		wg.Add(1)
+		go func(agent Agent) {
+			defer wg.Done()
+			status, err := a.fetch(agent)
+			if err != nil {
+				log.Println("error polling agent ", agent.Name, " ", err)
+				results <- AgentState{Agent: agent, Error: err.Error()}
+				return
+			}
+			results <- AgentState{Agent: agent, Reachable: true, LastSeen: time.Now(), Status: &status}
+		}(agent)
+	}
+	wg.Wait()
+	close(results)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for result := range results {
+		// Keep the last status of an unreachable agent until it's too old
+		if !result.Reachable {
+			if previous, ok := a.state[result.Name]; ok {
+				result.LastSeen = previous.LastSeen
+				result.Status = previous.Status
+			}
+		}
+		a.state[result.Name] = result
+	}
+	a.view = a.aggregate(time.Now())
+
+	log.Println("polled ", len(a.agents), " agents, tip=", a.view.Tip, " disagreements=", a.view.Disagreements)
+}
+
+// Combines the agent states, statuses older than maxAge are ignored
+func (a *Aggregator) aggregate(now time.Time) (view PoolView) {
+	view = PoolView{Time: now, Agents: []AgentState{}, Nodes: []NodeView{}, Disagreements: []string{}}
+
+	nodes := map[string]*NodeView{}
+	order := []string{}
+
+	for _, agent := range a.agents {
+		state, ok := a.state[agent.Name]
+		if !ok {
+			state.Agent = agent
+		}
+		view.Agents = append(view.Agents, state)
+
+		if state.Status == nil || now.Sub(state.LastSeen) > a.maxAge {
+			continue
+		}
+		status := state.Status
+
+		node, ok := nodes[status.RpcUri]
+		if !ok {
+			node = &NodeView{RpcUri: status.RpcUri, Views: []AgentView{}}
+			nodes[status.RpcUri] = node
+			order = append(order, status.RpcUri)
+		}
+
+		agentView := AgentView{Agent: agent.Name, Answer: status.Status, Verdict: status.Verdict}
+		agentView.Status, agentView.Reason = parseAnswer(status.Status)
+
+		// Every snapshot an agent has seen, its target and its references, counts towards the tip
+		if eval := status.Evaluation; eval != nil {
+			agentView.Updated = eval.Time
+			agentView.Slot = eval.Target.CurrentSlot
+			if eval.Target.Identity != "" {
+				node.Identity = eval.Target.Identity
+			}
+			if eval.Target.CurrentSlot > node.Slot {
+				node.Slot = eval.Target.CurrentSlot
+			}
+
+			for _, snapshot := range append([]solanahc.NodeSnapshot{eval.Target}, eval.References...) {
+				if !snapshot.HasErrors && snapshot.CurrentSlot > view.Tip {
+					view.Tip = snapshot.CurrentSlot
+					view.TipNode = snapshot.RpcNode
+				}
+			}
+		}
+
+		switch agentView.Status {
+		case string(solanahc.StatusUp):
+			node.Up++
+		case string(solanahc.StatusDrain):
+			node.Drain++
+		case statusMaint:
+			node.Maint++
+		default:
+			node.Down++
+		}
+		node.Views = append(node.Views, agentView)
+	}
+
+	sort.Strings(order)
+	for _, rpcUri := range order {
+		node := nodes[rpcUri]
+		node.Disagreement = countNonZero(node.Up, node.Down, node.Drain, node.Maint) > 1
+		if node.Disagreement {
+			view.Disagreements = append(view.Disagreements, rpcUri)
+		}
+		if node.Slot > 0 {
+			node.Behind = int64(view.Tip) - int64(node.Slot)
+		}
+		view.Nodes = append(view.Nodes, *node)
+	}
+	return
+}
+
+// haproxy answers maint only to the agent, it's not a verdict of the health checks
+const statusMaint = "maint"
+
+// Returns the state haproxy puts the server in for an agent answer such as "drain up #holes"
+// or "ready up", and the reason. Maintenance wins over down, down over drain.
+func parseAnswer(answer string) (status string, reason string) {
+	if i := strings.Index(answer, " #"); i >= 0 {
+		answer, reason = answer[:i], answer[i+2:]
+	}
+
+	words := map[string]bool{}
+	for _, word := range strings.Fields(answer) {
+		words[word] = true
+	}
+	switch {
+	case words[statusMaint]:
+		status = statusMaint
+	case words[string(solanahc.StatusDown)]:
+		status = string(solanahc.StatusDown)
+	case words[string(solanahc.StatusDrain)]:
+		status = string(solanahc.StatusDrain)
+	case words[string(solanahc.StatusUp)]:
+		status = string(solanahc.StatusUp)
+	default:
+		status = answer
+	}
+	return
+}
+
+func countNonZero(counts ...int) (n int) {
+	for _, c := range counts {
+		if c > 0 {
+			n++
+		}
+	}
+	return
+}
+
+func (a *Aggregator) View() PoolView {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.view
+}
+
+func (a *Aggregator) Run(schedule time.Duration) {
+	ticker := time.NewTicker(schedule)
+
+	for {
+		a.Poll()
+		<-ticker.C
+	}
+}
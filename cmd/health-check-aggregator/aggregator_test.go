@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+func TestParseAgents(t *testing.T) {
+	tests := []struct {
+		list   string
+		agents []Agent
+		ok     bool
+	}{
+		{list: "", ok: true},
+		{list: " , ", ok: true},
+		{list: "lb1=http://10.0.0.1:9998/", agents: []Agent{{Name: "lb1", Url: "http://10.0.0.1:9998"}}, ok: true},
+		{list: "http://10.0.0.1:9998", agents: []Agent{{Name: "http://10.0.0.1:9998", Url: "http://10.0.0.1:9998"}}, ok: true},
+		{list: "http://10.0.0.1:9998/?a=b", agents: []Agent{{Name: "http://10.0.0.1:9998/?a=b", Url: "http://10.0.0.1:9998/?a=b"}}, ok: true},
+		{list: "lb1=http://a:9998, lb2=http://b:9998", agents: []Agent{{Name: "lb1", Url: "http://a:9998"}, {Name: "lb2", Url: "http://b:9998"}}, ok: true},
+		{list: "lb1=10.0.0.1:9998", ok: false},
+		{list: "lb1", ok: false},
+	}
+	for _, test := range tests {
+		agents, err := ParseAgents(test.list)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got error %v, want ok %v", test.list, err, test.ok)
+			continue
+		}
+		if test.ok && !reflect.DeepEqual(agents, test.agents) {
+			t.Errorf("%q: got %+v, want %+v", test.list, agents, test.agents)
+		}
+	}
+}
+
+func TestParseAnswer(t *testing.T) {
+	tests := []struct {
+		answer string
+		status string
+		reason string
+	}{
+		{answer: "up", status: "up"},
+		{answer: "ready up", status: "up"},
+		{answer: "down #behind", status: "down", reason: "behind"},
+		{answer: "drain up #holes", status: "drain", reason: "holes"},
+		{answer: "drain down #behind", status: "down", reason: "behind"},
+		{answer: "up #peerdisagree,behind,quorum=1/2", status: "up", reason: "peerdisagree,behind,quorum=1/2"},
+		{answer: "maint", status: "maint"},
+	}
+	for _, test := range tests {
+		status, reason := parseAnswer(test.answer)
+		if status != test.status || reason != test.reason {
+			t.Errorf("%q: got %q #%q, want %q #%q", test.answer, status, reason, test.status, test.reason)
+		}
+	}
+}
+
+// Returns the status of an agent that saw the target at slot with a reference at tip
+func newTestStatus(rpcUri string, answer string, verdict string, slot solanarpc.Slot, tip solanarpc.Slot) *solanahc.AgentStatus {
+	return &solanahc.AgentStatus{
+		RpcUri:  rpcUri,
+		Status:  answer,
+		Verdict: verdict,
+		Evaluation: &solanahc.Evaluation{
+			Target:     solanahc.NodeSnapshot{RpcNode: rpcUri, CurrentSlot: slot},
+			References: []solanahc.NodeSnapshot{{RpcNode: "http://ref:8899", CurrentSlot: tip}},
+		},
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	agents := []Agent{{Name: "lb1"}, {Name: "lb2"}, {Name: "lb3"}, {Name: "lb4"}}
+	a := NewAggregator(agents, time.Second, time.Minute)
+	now := time.Now()
+
+	a.state["lb1"] = AgentState{Agent: agents[0], Reachable: true, LastSeen: now, Status: newTestStatus("http://a:8899", "up", "up", 990, 1000)}
+	a.state["lb2"] = AgentState{Agent: agents[1], Reachable: true, LastSeen: now, Status: newTestStatus("http://a:8899", "drain up #holes", "drain", 995, 1000)}
+	a.state["lb3"] = AgentState{Agent: agents[2], Reachable: true, LastSeen: now, Status: newTestStatus("http://b:8899", "maint", "up", 800, 1005)}
+	// lb4 was never reached
+
+	view := a.aggregate(now)
+	if view.Tip != 1005 || view.TipNode != "http://ref:8899" {
+		t.Errorf("got tip %d on %s, want 1005 on the reference", view.Tip, view.TipNode)
+	}
+	if len(view.Agents) != 4 || view.Agents[3].Reachable {
+		t.Errorf("unexpected agents %+v", view.Agents)
+	}
+	if !reflect.DeepEqual(view.Disagreements, []string{"http://a:8899"}) {
+		t.Errorf("got disagreements %v", view.Disagreements)
+	}
+	if len(view.Nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(view.Nodes))
+	}
+
+	a8899, b8899 := view.Nodes[0], view.Nodes[1]
+	if a8899.Up != 1 || a8899.Drain != 1 || a8899.Down != 0 || a8899.Maint != 0 || a8899.Slot != 995 || a8899.Behind != 10 {
+		t.Errorf("unexpected node %+v", a8899)
+	}
+	if drained := a8899.Views[1]; drained.Status != "drain" || drained.Reason != "holes" || drained.Answer != "drain up #holes" || drained.Verdict != "drain" {
+		t.Errorf("unexpected view %+v", drained)
+	}
+	// The answer counts, not the verdict of the checks
+	if b8899.Maint != 1 || b8899.Up != 0 || b8899.Disagreement || b8899.Behind != 205 {
+		t.Errorf("unexpected node %+v", b8899)
+	}
+}
+
+func TestAggregateMaxAge(t *testing.T) {
+	agents := []Agent{{Name: "lb1"}, {Name: "lb2"}}
+	a := NewAggregator(agents, time.Second, time.Minute)
+	now := time.Now()
+
+	a.state["lb1"] = AgentState{Agent: agents[0], Reachable: true, LastSeen: now, Status: newTestStatus("http://a:8899", "up", "up", 1000, 1000)}
+	a.state["lb2"] = AgentState{Agent: agents[1], LastSeen: now.Add(-30 * time.Second), Status: newTestStatus("http://a:8899", "down #behind", "down", 900, 2000)}
+
+	view := a.aggregate(now)
+	if node := view.Nodes[0]; node.Up != 1 || node.Down != 1 || !node.Disagreement || view.Tip != 2000 {
+		t.Errorf("status within max age: unexpected view %+v", view)
+	}
+
+	view = a.aggregate(now.Add(45 * time.Second))
+	if node := view.Nodes[0]; node.Up != 1 || node.Down != 0 || node.Disagreement || len(node.Views) != 1 {
+		t.Errorf("status past max age: unexpected node %+v", node)
+	}
+	if view.Tip != 1000 {
+		t.Errorf("status past max age still counts towards the tip %d", view.Tip)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	status := newTestStatus("http://a:8899", "down #behind", "down", 900, 1000)
+	lb1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	}))
+	defer lb1.Close()
+	lb2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer lb2.Close()
+
+	a := NewAggregator([]Agent{{Name: "lb1", Url: lb1.URL}, {Name: "lb2", Url: lb2.URL}}, time.Second, time.Minute)
+	a.Poll()
+
+	view := a.View()
+	if !view.Agents[0].Reachable || view.Agents[1].Reachable || view.Agents[1].Error == "" {
+		t.Errorf("unexpected agents %+v", view.Agents)
+	}
+	if len(view.Nodes) != 1 || view.Nodes[0].Down != 1 || view.Nodes[0].Views[0].Reason != "behind" {
+		t.Fatalf("unexpected nodes %+v", view.Nodes)
+	}
+
+	// An agent that stops answering keeps its last status until it's older than max age
+	lb1.Close()
+	a.Poll()
+	view = a.View()
+	if view.Agents[0].Reachable || len(view.Nodes) != 1 || view.Nodes[0].Down != 1 {
+		t.Errorf("unexpected view after the agent went away %+v", view)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	addr     = flag.String("addr", ":9991", "Listen address")
+	agents   = flag.String("agents", "", "Comma separated list of agent status APIs as name=url, e.g. lb1=http://10.0.0.1:9998")
+	interval = flag.Duration("interval", 10*time.Second, "Interval between polls of the agents")
+	timeout  = flag.Duration("timeout", 5*time.Second, "Timeout for polling a single agent")
+	maxAge   = flag.Duration("max-age", time.Minute, "Ignore the status of an agent that couldn't be polled for this long")
+)
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("error writing response ", err)
+	}
+}
+
+// Writes the pool view as a table of nodes with the verdict of every agent
+func writeTable(w http.ResponseWriter, view PoolView) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	names := []string{}
+	for _, agent := range view.Agents {
+		names = append(names, agent.Name)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "tip: %d (%s)\n\n", view.Tip, view.TipNode)
+	fmt.Fprintf(tw, "RPC\tSLOT\tBEHIND\tUP\tDOWN\tDRAIN\tMAINT\tDISAGREE\t%s\n", strings.Join(names, "\t"))
+	for _, node := range view.Nodes {
+		statuses := map[string]string{}
+		for _, v := range node.Views {
+			statuses[v.Agent] = v.Status
+			if v.Reason != "" {
+				statuses[v.Agent] += " #" + v.Reason
+			}
+		}
+		columns := []string{}
+		for _, name := range names {
+			status, ok := statuses[name]
+			if !ok {
+				status = "-"
+			}
+			columns = append(columns, status)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%t\t%s\n", node.RpcUri, node.Slot, node.Behind, node.Up, node.Down, node.Drain, node.Maint, node.Disagreement, strings.Join(columns, "\t"))
+	}
+	tw.Flush()
+}
+
+func main() {
+	flag.Parse()
+
+	agentList, err := ParseAgents(*agents)
+	if err != nil {
+		log.Fatal("invalid -agents: ", err)
+	}
+	if len(agentList) == 0 {
+		log.Fatal("need at least one agent")
+	}
+
+	aggregator := NewAggregator(agentList, *timeout, *maxAge)
+	go aggregator.Run(*interval)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/pool", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "table" {
+			writeTable(w, aggregator.View())
+			return
+		}
+		writeJSON(w, http.StatusOK, aggregator.View())
+	})
+	mux.HandleFunc("/v1/disagreements", func(w http.ResponseWriter, r *http.Request) {
+		view := aggregator.View()
+		nodes := []NodeView{}
+		for _, node := range view.Nodes {
+			if node.Disagreement {
+				nodes = append(nodes, node)
+			}
+		}
+		writeJSON(w, http.StatusOK, nodes)
+	})
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal("listen error: ", err)
+	}
+	log.Printf("listening on %s, polling %d agents", *addr, len(agentList))
+
+	if err := http.Serve(listener, mux); err != nil {
+		log.Fatal("serve error: ", err)
+	}
+}
@@ -1,35 +1,215 @@
 package main
 
 import (
-  "log"
-  "net/rpc"
-  solRpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+var (
+	server  = flag.String("server", "http://127.0.0.1:9990", "Address of the health-check-server")
+	output  = flag.String("output", "table", "Output format, table or json")
+	watch   = flag.Bool("watch", false, "Keep printing the node verdicts as the server updates them")
+	count   = flag.Int("n", 10, "Number of evaluations shown by history")
+	timeout = flag.Duration("timeout", 10*time.Second, "Timeout for requests to the server (not applied to watch)")
 )
 
-type Args struct {
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] [command]
+
+Commands:
+  nodes          verdicts of all monitored nodes (default)
+  node <rpc>     verdict and checks of a single node
+  history <rpc>  the last -n evaluations of a node
+  states         node states of the last round, including reference servers
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func get(path string, query url.Values, v interface{}) error {
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(*server + "/" + solanahc.ApiVersion + path + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatal("error encoding output ", err)
+	}
+}
+
+func slot(state *solanahc.NodeSnapshot) string {
+	if state == nil {
+		return "-"
+	}
+	return fmt.Sprint(state.CurrentSlot)
+}
+
+func printNodes(w io.Writer, nodes []solanahc.NodeStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RPC\tSTATUS\tREASON\tSLOT\tALIVE\tUPDATED")
+	for _, n := range nodes {
+		updated := "-"
+		if !n.Updated.IsZero() {
+			updated = n.Updated.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\n", n.RpcUri, n.Status, n.Reason, slot(n.State), n.Alive, updated)
+	}
+	tw.Flush()
 }
 
+func printNode(w io.Writer, n solanahc.NodeStatus) {
+	printNodes(w, []solanahc.NodeStatus{n})
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSEVERITY\tACTIVE\tFAILING\tPASSES\tFAILURES\tREASON")
+	for _, cs := range n.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%d\t%d\t%s\n", cs.Name, cs.Severity, cs.Active, cs.Failing, cs.Passes, cs.Failures, cs.Reason)
+	}
+	tw.Flush()
+}
 
-type State struct {
-  MinimumSlot solRpc.Slot
-  CurrentSlot solRpc.Slot
-  PrevEpochBlocks uint64
-  CurEpochBlocks uint64
+func printHistory(w io.Writer, history []solanahc.Evaluation) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSTATUS\tSLOT\tREFERENCE\tREFERENCES\tLOADFAILURE")
+	for _, e := range history {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", e.Time.Format(time.RFC3339), e.Status, e.Target.CurrentSlot, e.Reference.Slot, len(e.References), e.LoadFailure)
+	}
+	tw.Flush()
 }
 
+func printStates(w io.Writer, states []solanahc.NodeSnapshot) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RPC\tSLOT\tPROCESSED\tMINIMUM\tMAXRETRANSMIT\tEPOCH\tVERSION")
+	for _, s := range states {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", s.RpcNode, s.CurrentSlot, s.ProcessedSlot, s.MinimumSlot, s.MaxRetransmitSlot, s.Epoch.Epoch, s.Version.CoreVersion)
+	}
+	tw.Flush()
+}
+
+// Follows the update stream of the server until it closes
+func watchNodes() error {
+	resp, err := http.Get(*server + "/" + solanahc.ApiVersion + "/watch")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var update solanahc.StatusUpdate
+		if err := decoder.Decode(&update); err != nil {
+			return err
+		}
+
+		if *output == "json" {
+			if err := json.NewEncoder(os.Stdout).Encode(update); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Println(update.Time.Format(time.RFC3339))
+		printNodes(os.Stdout, update.Nodes)
+		fmt.Println()
+	}
+}
 
 func main() {
-  client, err := rpc.DialHTTP("tcp", "127.0.0.1:9990")
-  if err != nil {
-    log.Fatal("dialing:", err)
-  }
-
-  var state State
-  var args Args
-  err = client.Call("Health.GetState", &args, &state)
-  if err != nil {
-    log.Fatal("health error:", err)
-  }
-
-  log.Printf("slots=%d", state.MinimumSlot)
+	flag.Usage = usage
+	flag.Parse()
+
+	if *output != "table" && *output != "json" {
+		log.Fatal("invalid -output ", *output)
+	}
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "nodes"
+	}
+	query := url.Values{}
+	if flag.NArg() > 1 {
+		query.Set("rpc", flag.Arg(1))
+	}
+
+	var err error
+	switch command {
+	case "nodes":
+		if *watch {
+			err = watchNodes()
+			break
+		}
+		var nodes []solanahc.NodeStatus
+		if err = get("/nodes", query, &nodes); err == nil {
+			if *output == "json" {
+				printJSON(nodes)
+			} else {
+				printNodes(os.Stdout, nodes)
+			}
+		}
+	case "node":
+		var node solanahc.NodeStatus
+		if err = get("/node", query, &node); err == nil {
+			if *output == "json" {
+				printJSON(node)
+			} else {
+				printNode(os.Stdout, node)
+			}
+		}
+	case "history":
+		query.Set("n", fmt.Sprint(*count))
+		var history []solanahc.Evaluation
+		if err = get("/history", query, &history); err == nil {
+			if *output == "json" {
+				printJSON(history)
+			} else {
+				printHistory(os.Stdout, history)
+			}
+		}
+	case "states":
+		var states []solanahc.NodeSnapshot
+		if err = get("/states", query, &states); err == nil {
+			if *output == "json" {
+				printJSON(states)
+			} else {
+				printStates(os.Stdout, states)
+			}
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal("health error: ", err)
+	}
 }
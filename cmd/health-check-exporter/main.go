@@ -34,6 +34,9 @@ type Exporter struct {
 	slotsStoredDesc     *prometheus.Desc
 	prevEpochBlocksDesc *prometheus.Desc
 	curEpochBlocksDesc  *prometheus.Desc
+	healthyDesc         *prometheus.Desc
+	slotsBehindDesc     *prometheus.Desc
+	blockTimeLagDesc    *prometheus.Desc
 }
 
 func NewExporter(uri string) *Exporter {
@@ -49,7 +52,7 @@ func NewExporter(uri string) *Exporter {
 			[]string{"rpc", "version", "feature_set", "identity", "genesis_hash"}, nil),
 		currentSlotDesc: prometheus.NewDesc(
 			"solana_current_slot",
-			"The current slot stored by RPC server",
+			"The current (confirmed) slot of the RPC server",
 			[]string{"rpc"}, nil),
 		processedSlotDesc: prometheus.NewDesc(
 			"solana_processed_slot",
@@ -71,6 +74,18 @@ func NewExporter(uri string) *Exporter {
 			"solana_current_epoch_blocks",
 			"The number of blocks from current epoch stored by RPC server",
 			[]string{"rpc"}, nil),
+		healthyDesc: prometheus.NewDesc(
+			"solana_node_healthy",
+			"Whether the RPC server reports itself as healthy with getHealth",
+			[]string{"rpc"}, nil),
+		slotsBehindDesc: prometheus.NewDesc(
+			"solana_node_slots_behind",
+			"The number of slots the RPC server reports to be behind the cluster, 0 if it is healthy",
+			[]string{"rpc"}, nil),
+		blockTimeLagDesc: prometheus.NewDesc(
+			"solana_block_time_lag_seconds",
+			"Seconds since the block at the current slot of the RPC server was produced",
+			[]string{"rpc"}, nil),
 	}
 }
 
@@ -83,6 +98,9 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.slotsStoredDesc
 	ch <- e.prevEpochBlocksDesc
 	ch <- e.curEpochBlocksDesc
+	ch <- e.healthyDesc
+	ch <- e.slotsBehindDesc
+	ch <- e.blockTimeLagDesc
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
@@ -114,6 +132,15 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(e.currentSlotDesc, prometheus.GaugeValue, float64(nodeState.CurrentSlot), e.rpcURI)
 		ch <- prometheus.MustNewConstMetric(e.processedSlotDesc, prometheus.GaugeValue, float64(nodeState.ProcessedSlot), e.rpcURI)
 		ch <- prometheus.MustNewConstMetric(e.slotsStoredDesc, prometheus.GaugeValue, float64(nodeState.CurrentSlot-nodeState.MinimumSlot), e.rpcURI)
+
+		// Without a block time there is no lag to export, the scrape goes on without the sample
+		err = nodeState.LoadBlockTime()
+		if err != nil {
+			log.Println("error loading block time ", err)
+		} else if nodeState.BlockTime > 0 {
+			lag := solanahc.BlockAge(nodeState.BlockTime, time.Now())
+			ch <- prometheus.MustNewConstMetric(e.blockTimeLagDesc, prometheus.GaugeValue, lag.Seconds(), e.rpcURI)
+		}
 	}
 
 	err = nodeState.LoadMeta()
@@ -123,6 +150,24 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(e.infoDesc, prometheus.GaugeValue, float64(1), e.rpcURI, nodeState.Version.CoreVersion, strconv.Itoa(int(nodeState.Version.FeatureSet)), nodeState.Identity.Identity, nodeState.GenesisHash)
 	}
 
+	// A node that can't be reached has no health sample rather than failing the whole scrape
+	err = nodeState.LoadHealth()
+	if err != nil {
+		log.Println("error loading health ", err)
+	} else {
+		var healthy float64
+		if nodeState.Health.Healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(e.healthyDesc, prometheus.GaugeValue, healthy, e.rpcURI)
+		// An unhealthy node doesn't always know how far it is behind
+		if nodeState.Health.Healthy {
+			ch <- prometheus.MustNewConstMetric(e.slotsBehindDesc, prometheus.GaugeValue, 0, e.rpcURI)
+		} else if behind := nodeState.Health.NumSlotsBehind; behind != nil {
+			ch <- prometheus.MustNewConstMetric(e.slotsBehindDesc, prometheus.GaugeValue, float64(*behind), e.rpcURI)
+		}
+	}
+
 	mutex.Lock()
 	ch <- prometheus.MustNewConstMetric(e.poolDesc, prometheus.GaugeValue, float64(1), e.rpcURI, *poolName, *region)
 	mutex.Unlock()
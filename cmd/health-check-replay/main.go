@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+var (
+	recording      = flag.String("recording", "", "File recorded with -record by the haproxy agent")
+	rpcURI         = flag.String("rpc", "http://localhost:8899", "Solana RPC URI (including protocol and path) the agent checked")
+	verbose        = flag.Bool("v", false, "Print the log of the health check")
+	profilesPath   = flag.String("profiles", "", "JSON file with the check profiles of the agent")
+	profile        = flag.String("profile", "", "Print the answers of this profile from -profiles, e.g. the shadow profile, instead of the default ones")
+	checkFlags     = solanahc.RegisterCheckFlags(flag.CommandLine)
+	dampeningFlags = solanahc.RegisterDampeningFlags(flag.CommandLine)
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -recording file [flags]\n\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Replays a recording of the rpc traffic of the haproxy agent and prints the answer after every health check.")
+	fmt.Fprintln(flag.CommandLine.Output(), "The rpc, reference and enabled checks have to be the ones of the agent, the thresholds can be changed.")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Lookup("reference-servers").Usage = "Comma separated list of reference servers the agent checked against"
+	flag.Parse()
+
+	if *recording == "" {
+		usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	replayer, err := solanarpc.LoadReplayer(*recording)
+	if err != nil {
+		log.SetOutput(os.Stderr)
+		log.Fatal("couldn't load recording ", err)
+	}
+
+	levels, fallback, err := checkFlags.Levels()
+	if err != nil {
+		log.SetOutput(os.Stderr)
+		log.Fatal("invalid -check-levels: ", err)
+	}
+
+	config := checkFlags.Config()
+
+	profiles, err := solanahc.LoadProfiles(*profilesPath, config, levels, fallback)
+	if err != nil {
+		log.SetOutput(os.Stderr)
+		log.Fatal("couldn't load profiles: ", err)
+	}
+	if _, ok := profiles[*profile]; *profile != "" && !ok {
+		log.SetOutput(os.Stderr)
+		log.Fatal("unknown profile ", *profile)
+	}
+
+	// Time only advances with the recorded responses, which also drives the stall check and the dampening
+	health_state := solanahc.NewHealthState(*rpcURI, config, levels, fallback)
+	health_state.Clock = replayer.Now
+	health_state.Profiles = profiles
+	health_state.Dampener = dampeningFlags.Dampener()
+	monitor := solanahc.NewMonitor([]*solanahc.HealthState{health_state}, checkFlags.References())
+	monitor.Transport = replayer
+
+	// Every check uses up the responses recorded for it, stop once a check doesn't find any
+	checks := 0
+	previous := ""
+	for replayer.Remaining() > 0 {
+		remaining := replayer.Remaining()
+		monitor.Check()
+		if replayer.Remaining() == remaining {
+			break
+		}
+		checks++
+
+		status := health_state.GetStatus()
+		if *profile != "" {
+			profileStatus, reason, _ := health_state.GetProfileVerdict(*profile)
+			status = solanahc.FormatStatus(profileStatus, reason)
+		}
+		line := replayer.Now().Format(time.RFC3339) + " " + status
+		if checks > 1 && status != previous {
+			line += " (changed)"
+		}
+		previous = status
+		fmt.Println(line)
+	}
+
+	fmt.Fprintf(os.Stderr, "replayed %d checks, %d recorded responses unused\n", checks, replayer.Remaining())
+}
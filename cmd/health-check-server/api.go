@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+// Serves the node states, verdicts and history of a monitor as JSON
+type ApiServer struct {
+	monitor *solanahc.Monitor
+
+	mu       sync.Mutex
+	watchers map[chan solanahc.StatusUpdate]struct{}
+}
+
+func NewApiServer(monitor *solanahc.Monitor) *ApiServer {
+	api := &ApiServer{
+		monitor:  monitor,
+		watchers: map[chan solanahc.StatusUpdate]struct{}{},
+	}
+	monitor.OnEvaluated(api.broadcast)
+	return api
+}
+
+func (api *ApiServer) Handler() http.Handler {
+	prefix := "/" + solanahc.ApiVersion
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/nodes", api.handleNodes)
+	mux.HandleFunc(prefix+"/node", api.handleNode)
+	mux.HandleFunc(prefix+"/history", api.handleHistory)
+	mux.HandleFunc(prefix+"/states", api.handleStates)
+	mux.HandleFunc(prefix+"/watch", api.handleWatch)
+	return mux
+}
+
+func (api *ApiServer) update() solanahc.StatusUpdate {
+	update := solanahc.StatusUpdate{Time: time.Now(), Nodes: []solanahc.NodeStatus{}}
+	for _, t := range api.monitor.Targets() {
+		update.Nodes = append(update.Nodes, solanahc.NewNodeStatus(t))
+	}
+	return update
+}
+
+// Looks up the node given by ?rpc=, writing an error if there is none
+func (api *ApiServer) target(w http.ResponseWriter, r *http.Request) *solanahc.HealthState {
+	rpcUri := r.URL.Query().Get("rpc")
+	if rpcUri == "" {
+		http.Error(w, "missing rpc", http.StatusBadRequest)
+		return nil
+	}
+	t := api.monitor.Target(rpcUri)
+	if t == nil {
+		http.Error(w, "unknown rpc", http.StatusNotFound)
+	}
+	return t
+}
+
+// Returns the verdicts of all nodes
+func (api *ApiServer) handleNodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.update().Nodes)
+}
+
+// Returns the verdict of a single node (?rpc=)
+func (api *ApiServer) handleNode(w http.ResponseWriter, r *http.Request) {
+	if t := api.target(w, r); t != nil {
+		writeJSON(w, http.StatusOK, solanahc.NewNodeStatus(t))
+	}
+}
+
+// Returns the last n evaluations of a node (?rpc=&n=), oldest first
+func (api *ApiServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	t := api.target(w, r)
+	if t == nil {
+		return
+	}
+
+	n := 0
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, "invalid value for n", http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, t.History(n))
+}
+
+// Returns the node states of the last round, including the reference servers
+func (api *ApiServer) handleStates(w http.ResponseWriter, r *http.Request) {
+	states := api.monitor.States()
+	if states == nil {
+		states = []solanahc.NodeSnapshot{}
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+// Streams a StatusUpdate as a line of JSON after every round of evaluations
+func (api *ApiServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	updates := make(chan solanahc.StatusUpdate, 1)
+	api.mu.Lock()
+	api.watchers[updates] = struct{}{}
+	api.mu.Unlock()
+	defer func() {
+		api.mu.Lock()
+		delete(api.watchers, updates)
+		api.mu.Unlock()
+	}()
+
+	log.Println("watcher connected ", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	update := api.update()
+	for {
+		if err := encoder.Encode(update); err != nil {
+			log.Println("watcher disconnected ", r.RemoteAddr, " ", err)
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case update = <-updates:
+		case <-r.Context().Done():
+			log.Println("watcher disconnected ", r.RemoteAddr)
+			return
+		}
+	}
+}
+
+// Sends the current verdicts to every watcher, a slow watcher only gets the latest update
+func (api *ApiServer) broadcast() {
+	update := api.update()
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	for watcher := range api.watchers {
+		select {
+		case <-watcher:
+		default:
+		}
+		watcher <- update
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("error writing response ", err)
+	}
+}
@@ -5,53 +5,48 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"net/rpc"
+	"time"
 
 	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
-	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
 )
 
 var (
-	rpcURI     = flag.String("rpc", "http://localhost:8899", "Solana RPC URI (including protocol and path)")
-	addr       = flag.String("addr", ":9990", "Listen address")
-	rpcTimeout = flag.Int("rpc-timeout", 10, "Timeout per rpc call")
+	rpcURIs      = flag.String("rpc", "http://localhost:8899", "Comma separated list of Solana RPC URIs (including protocol and path) to monitor")
+	addr         = flag.String("addr", ":9990", "Listen address")
+	rpcTimeout   = flag.Int("rpc-timeout", 10, "Timeout per rpc call")
+	interval     = flag.Duration("interval", 10*time.Second, "Interval between health checks")
+	history      = flag.Int("history", solanahc.DefaultHistorySize, "Number of evaluations kept per node")
+	compareNodes = flag.Bool("compare-nodes", false, "Also compare every node against the other monitored nodes")
+	checkFlags   = solanahc.RegisterCheckFlags(flag.CommandLine)
 )
 
-type Args struct {
-}
-
-type State struct {
-	MinimumSlot     solanarpc.Slot
-	CurrentSlot     solanarpc.Slot
-	PrevEpochBlocks uint64
-	CurEpochBlocks  uint64
-}
+func main() {
+	flag.Parse()
 
-type Health int
+	solanahc.RpcTimeout = time.Duration(*rpcTimeout) * time.Second
 
-func (t *Health) GetState(args *Args, reply *State) error {
-	var state State
-	nodestate := solanahc.NewNodeState(*rpcURI)
-	nodestate.LoadSlots()
+	levels, fallback, err := checkFlags.Levels()
+	if err != nil {
+		log.Fatal("invalid -check-levels: ", err)
+	}
 
-	state.MinimumSlot = 100
-	state.CurrentSlot = 100
-	state.PrevEpochBlocks = 100
-	state.CurEpochBlocks = 100
+	config := checkFlags.Config()
 
-	*reply = state
-	return nil
-}
+	targets := []*solanahc.HealthState{}
+	for _, rpcUri := range solanahc.SplitList(*rpcURIs) {
+		state := solanahc.NewHealthState(rpcUri, config, levels, fallback)
+		state.HistorySize = *history
+		targets = append(targets, state)
+	}
+	if len(targets) == 0 {
+		log.Fatal("need at least one rpc")
+	}
 
-func main() {
-	flag.Parse()
+	monitor := solanahc.NewMonitor(targets, checkFlags.References())
+	monitor.CompareTargets = *compareNodes
+	api := NewApiServer(monitor)
+	go monitor.Run(*interval)
 
-	health := new(Health)
-	err := rpc.Register(health)
-	if err != nil {
-		log.Fatal("Format of service isn't correct. ", err)
-	}
-	rpc.HandleHTTP()
 	listener, e := net.Listen("tcp", *addr)
 	if e != nil {
 		log.Fatal("Listen error:", e)
@@ -59,7 +54,7 @@ func main() {
 
 	log.Printf("listening on %s", *addr)
 
-	err = http.Serve(listener, nil)
+	err = http.Serve(listener, api.Handler())
 	if err != nil {
 		log.Fatal("serve error: ", err)
 	}
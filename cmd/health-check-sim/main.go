@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/linuskendall/solana-rpc-health-check/health-check/simulation"
+)
+
+var (
+	verbose = flag.Bool("v", false, "Print the log of the health check")
+	steps   = flag.Bool("steps", false, "Print the answer of every check instead of only the changes")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] scenario.sim...\n\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Runs scripted timelines against the health check and compares the answers with the expected ones.")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	failed := 0
+	for _, path := range flag.Args() {
+		sc, err := simulation.LoadScenario(path)
+		if err != nil {
+			fmt.Println("FAIL", path, err)
+			failed++
+			continue
+		}
+
+		result, err := sc.Run()
+		if err != nil {
+			fmt.Println("FAIL", sc.Name, err)
+			failed++
+			continue
+		}
+
+		shown := result.Changes()
+		if *steps {
+			shown = result.Steps
+		}
+		for _, step := range shown {
+			fmt.Printf("  %8s  %s\n", step.At, step.Answer)
+		}
+		for _, f := range result.Failures {
+			fmt.Println("  expectation failed:", f)
+		}
+
+		if len(result.Failures) > 0 {
+			fmt.Println("FAIL", sc.Name)
+			failed++
+		} else {
+			fmt.Println("ok  ", sc.Name)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d scenarios failed\n", failed, flag.NArg())
+		os.Exit(1)
+	}
+}
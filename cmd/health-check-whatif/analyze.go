@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	"github.com/linuskendall/solana-rpc-health-check/health-check/simulation"
+)
+
+type Candidate struct {
+	Name   string
+	Checks simulation.Checks
+}
+
+// A stretch of rounds with the same status
+type Period struct {
+	Start    time.Time
+	Duration time.Duration
+	Status   solanahc.Status
+	Reason   string
+	// The period lasted until the end of the log
+	Ongoing bool
+	// A down or drain period shorter than the flap window
+	Flap bool
+}
+
+type Report struct {
+	Candidate   string
+	Transitions int
+	Downtime    time.Duration
+	DrainTime   time.Duration
+	// The down and drain periods, without the one before the node first came up
+	Outages []Period
+	Flaps   int
+}
+
+// Evaluates the rounds with the checks of a candidate, as the agent would have
+func Analyze(c Candidate, rounds []Round, targetUri string, needsReferences bool, flapWindow time.Duration) (report Report) {
+	report.Candidate = c.Name
+	if len(rounds) == 0 {
+		return
+	}
+
+	var now time.Time
+	health_state := c.Checks.NewHealthState(targetUri)
+	health_state.Clock = func() time.Time { return now }
+
+	periods := []Period{}
+	for i, round := range rounds {
+		now = round.Time
+		if round.LoadFailure != "" {
+			health_state.EvaluateLoadFailure(round.LoadFailure)
+		} else {
+			health_state.Evaluate(round.Target, round.References, needsReferences)
+		}
+		status, reason := health_state.GetVerdict()
+
+		// A round lasts until the next one
+		var duration time.Duration
+		if i+1 < len(rounds) {
+			duration = rounds[i+1].Time.Sub(round.Time)
+		}
+
+		if len(periods) > 0 && periods[len(periods)-1].Status == status {
+			periods[len(periods)-1].Duration += duration
+			continue
+		}
+		periods = append(periods, Period{Start: round.Time, Duration: duration, Status: status, Reason: reason})
+	}
+	periods[len(periods)-1].Ongoing = true
+
+	report.Transitions = len(periods) - 1
+	for i, p := range periods {
+		if p.Status == solanahc.StatusUp {
+			continue
+		}
+		// The agent starts down until the first checks pass
+		if i == 0 && len(periods) > 1 {
+			continue
+		}
+		if p.Status == solanahc.StatusDown {
+			report.Downtime += p.Duration
+		} else {
+			report.DrainTime += p.Duration
+		}
+		p.Flap = !p.Ongoing && p.Duration < flapWindow
+		if p.Flap {
+			report.Flaps++
+		}
+		report.Outages = append(report.Outages, p)
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	"github.com/linuskendall/solana-rpc-health-check/health-check/simulation"
+	"github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+var testStart = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// Rounds 10s apart with the target the given number of slots behind its reference in each
+func testRounds(behind ...uint64) (rounds []Round) {
+	for i, b := range behind {
+		slot := rpc.Slot(1000 + 10*i)
+		target := solanahc.NodeSnapshot{RpcNode: "http://node:8899", CurrentSlot: slot - rpc.Slot(b), MaxRetransmitSlot: slot - rpc.Slot(b)}
+		reference := solanahc.NodeSnapshot{RpcNode: "http://ref:8899", CurrentSlot: slot, MaxRetransmitSlot: slot}
+		rounds = append(rounds, Round{Time: testStart.Add(time.Duration(i) * 10 * time.Second), Target: &target, References: []solanahc.NodeSnapshot{reference}})
+	}
+	return
+}
+
+func testCandidate(t *testing.T, options ...string) Candidate {
+	c := Candidate{Name: "test", Checks: simulation.DefaultChecks()}
+	if err := c.Checks.ParseOptions(append([]string{"up=1", "down=1"}, options...)); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestAnalyze(t *testing.T) {
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	// Up, a short outage, up again and an outage until the end of the log
+	rounds := testRounds(0, 0, 500, 500, 0, 0, 500, 500)
+
+	report := Analyze(testCandidate(t), rounds, "http://node:8899", true, time.Minute)
+	if report.Transitions != 3 || report.Downtime != 30*time.Second || report.DrainTime != 0 || report.Flaps != 1 || len(report.Outages) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	flap, ongoing := report.Outages[0], report.Outages[1]
+	if !flap.Start.Equal(testStart.Add(20*time.Second)) || flap.Duration != 20*time.Second || flap.Status != solanahc.StatusDown || flap.Reason != "behind" || !flap.Flap || flap.Ongoing {
+		t.Errorf("unexpected first outage %+v", flap)
+	}
+	if !ongoing.Start.Equal(testStart.Add(60*time.Second)) || ongoing.Duration != 10*time.Second || !ongoing.Ongoing || ongoing.Flap {
+		t.Errorf("unexpected second outage %+v", ongoing)
+	}
+
+	// A config that tolerates the lag never goes down
+	if report := Analyze(testCandidate(t, "slot-diff=1000"), rounds, "http://node:8899", true, time.Minute); report.Transitions != 0 || len(report.Outages) != 0 {
+		t.Errorf("unexpected report with a higher slot-diff %+v", report)
+	}
+	// Outages longer than the flap window aren't flaps
+	if report := Analyze(testCandidate(t), rounds, "http://node:8899", true, 10*time.Second); report.Flaps != 0 {
+		t.Errorf("got %d flaps with a short flap window", report.Flaps)
+	}
+}
+
+// The agent starts down until the first checks pass, that isn't an outage
+func TestAnalyzeStartup(t *testing.T) {
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	report := Analyze(testCandidate(t, "up=3"), testRounds(0, 0, 0, 0), "http://node:8899", true, time.Minute)
+	if report.Transitions != 1 || len(report.Outages) != 0 || report.Downtime != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// Without any passing check the whole log is an outage
+	report = Analyze(testCandidate(t), testRounds(500, 500), "http://node:8899", true, time.Minute)
+	if report.Transitions != 0 || len(report.Outages) != 1 || !report.Outages[0].Ongoing {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// Rounds that couldn't be loaded take the node down once it's stale, after more than 3
+	rounds := testRounds(0, 0, 0, 0, 0, 0)
+	for i := 1; i <= 4; i++ {
+		rounds[i] = Round{Time: rounds[i].Time, LoadFailure: "loadinghc"}
+	}
+	report = Analyze(testCandidate(t), rounds, "http://node:8899", true, time.Minute)
+	if report.Transitions != 2 || len(report.Outages) != 1 || report.Outages[0].Reason != "stale" || report.Outages[0].Duration != 10*time.Second {
+		t.Errorf("unexpected report with a load failure %+v", report)
+	}
+
+	if report := Analyze(testCandidate(t), nil, "http://node:8899", true, time.Minute); report.Transitions != 0 || report.Candidate != "test" {
+		t.Errorf("unexpected report without rounds %+v", report)
+	}
+}
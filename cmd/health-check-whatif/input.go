@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	"github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+// The node states loaded by one health check
+type Round struct {
+	Time       time.Time
+	Target     *solanahc.NodeSnapshot
+	References []solanahc.NodeSnapshot
+	// Set if the states couldn't be loaded
+	LoadFailure string
+}
+
+// Reads a -snapshot-log of the agent or the csv output of csv-health-check -watch.
+// In the csv the target is the node with the given rpc uri, or the first one.
+func LoadRounds(path string, target string) (rounds []Round, targetUri string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return readEvaluations(bytes.NewReader(data))
+	}
+	return readWatchCSV(bytes.NewReader(data), target)
+}
+
+func readEvaluations(r io.Reader) (rounds []Round, targetUri string, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var eval solanahc.Evaluation
+		if err = json.Unmarshal(scanner.Bytes(), &eval); err != nil {
+			return nil, "", fmt.Errorf("line %d: %v", line, err)
+		}
+
+		round := Round{Time: eval.Time, References: eval.References}
+		if eval.Target.RpcNode != "" {
+			target := eval.Target
+			round.Target = &target
+			targetUri = target.RpcNode
+		} else if eval.LoadFailure != "" && len(eval.References) == 0 {
+			// EvaluateLoadFailure, the monitor couldn't load the states
+			round.LoadFailure = eval.LoadFailure
+		}
+		rounds = append(rounds, round)
+	}
+	err = scanner.Err()
+	return
+}
+
+// Sets the field of a snapshot for a csv-health-check column, unknown columns are ignored
+func setColumn(s *solanahc.NodeSnapshot, column string, value string) (err error) {
+	if value == "" {
+		return nil
+	}
+	var n uint64
+	switch column {
+	case "minSlot", "curSlot", "finalizedSlot", "processedSlot", "maxRetransmitSlot", "epoch", "prevEpochBlocks", "curEpochBlocks", "latency":
+		if n, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid %s %q", column, value)
+		}
+	}
+	switch column {
+	case "rpcNode":
+		s.RpcNode = value
+	case "hasErrors":
+		s.HasErrors, err = strconv.ParseBool(value)
+	case "minSlot":
+		s.MinimumSlot = rpc.Slot(n)
+	case "curSlot":
+		s.CurrentSlot = rpc.Slot(n)
+	case "finalizedSlot":
+		s.FinalizedSlot = rpc.Slot(n)
+	case "processedSlot":
+		s.ProcessedSlot = rpc.Slot(n)
+	case "maxRetransmitSlot":
+		s.MaxRetransmitSlot = rpc.Slot(n)
+	case "epoch":
+		s.Epoch.Epoch = rpc.Epoch(n)
+	case "prevEpochBlocks":
+		s.PrevEpochBlocks = int(n)
+	case "curEpochBlocks":
+		s.CurEpochBlocks = int(n)
+	case "latency":
+		s.Latency = time.Duration(n) * time.Millisecond
+	case "genesis":
+		s.GenesisHash = value
+	case "identity":
+		s.Identity = value
+	case "version":
+		s.Version.CoreVersion = value
+	}
+	return
+}
+
+func sameRecord(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// The rows of a watch iteration share the time, nodes which couldn't be loaded have no row
+func readWatchCSV(r io.Reader, target string) (rounds []Round, targetUri string, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return
+	}
+
+	var header []string
+	var current *Round
+	count := 0
+	counts := []int{}
+	nodes := map[string]bool{}
+	finish := func() {
+		if current == nil {
+			return
+		}
+		rounds = append(rounds, *current)
+		counts = append(counts, count)
+	}
+
+	for i, record := range records {
+		// Every rotated file starts with the header again
+		if header == nil {
+			header = record
+			continue
+		}
+		if sameRecord(record, header) {
+			continue
+		}
+
+		snapshot := solanahc.NodeSnapshot{}
+		var at time.Time
+		for c, value := range record {
+			if c >= len(header) {
+				break
+			}
+			if header[c] == "time" {
+				if at, err = time.Parse(time.RFC3339, value); err != nil {
+					return nil, "", fmt.Errorf("line %d: invalid time %q", i+1, value)
+				}
+			} else if err = setColumn(&snapshot, header[c], value); err != nil {
+				return nil, "", fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+		if at.IsZero() {
+			return nil, "", fmt.Errorf("line %d: the time column is needed", i+1)
+		}
+		if snapshot.RpcNode == "" {
+			return nil, "", fmt.Errorf("line %d: the rpcNode column is needed", i+1)
+		}
+
+		if current == nil || !at.Equal(current.Time) {
+			finish()
+			current = &Round{Time: at}
+			count = 0
+		}
+		count++
+		nodes[snapshot.RpcNode] = true
+
+		if target == "" {
+			target = snapshot.RpcNode
+		}
+		if snapshot.RpcNode == target {
+			current.Target = &snapshot
+		} else if !snapshot.HasErrors {
+			current.References = append(current.References, snapshot)
+		}
+	}
+	finish()
+
+	// Like LoadStates the monitor needs two states, unless the target was watched standalone
+	if len(nodes) > 1 {
+		for i := range rounds {
+			if counts[i] < 2 {
+				rounds[i] = Round{Time: rounds[i].Time, LoadFailure: "loadinghc"}
+			}
+		}
+	}
+	return rounds, target, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadWatchCSV(t *testing.T) {
+	// Two rotated files concatenated, the header repeats in the middle
+	csv := `rpcNode,time,curSlot,hasErrors,latency
+http://node:8899,2021-03-01T12:00:00Z,990,false,20
+http://ref:8899,2021-03-01T12:00:00Z,1000,false,30
+rpcNode,time,curSlot,hasErrors,latency
+http://node:8899,2021-03-01T12:00:10Z,1000,false,20
+http://ref:8899,2021-03-01T12:00:10Z,,true,
+http://other:8899,2021-03-01T12:00:10Z,1010,false,25
+http://node:8899,2021-03-01T12:00:20Z,1020,false,20
+`
+	rounds, target, err := readWatchCSV(strings.NewReader(csv), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "http://node:8899" || len(rounds) != 3 {
+		t.Fatalf("got target %s and %d rounds", target, len(rounds))
+	}
+
+	first := rounds[0]
+	if !first.Time.Equal(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)) || first.Target == nil || first.Target.CurrentSlot != 990 || first.Target.Latency != 20*time.Millisecond {
+		t.Errorf("unexpected first round %+v", first)
+	}
+	if len(first.References) != 1 || first.References[0].CurrentSlot != 1000 {
+		t.Errorf("unexpected references %+v", first.References)
+	}
+	// A reference that failed to load is left out
+	if second := rounds[1]; len(second.References) != 1 || second.References[0].RpcNode != "http://other:8899" {
+		t.Errorf("unexpected references of the second round %+v", second.References)
+	}
+	// A round with a single row couldn't have been checked against the references
+	if third := rounds[2]; third.LoadFailure != "loadinghc" || third.Target != nil {
+		t.Errorf("unexpected third round %+v", third)
+	}
+
+	// Another node can be the target
+	rounds, target, err = readWatchCSV(strings.NewReader(csv), "http://ref:8899")
+	if err != nil || target != "http://ref:8899" || rounds[0].Target.CurrentSlot != 1000 || !rounds[1].Target.HasErrors {
+		t.Errorf("unexpected rounds for another target %+v (%v)", rounds, err)
+	}
+}
+
+// A node watched alone is checked without references
+func TestReadWatchCSVStandalone(t *testing.T) {
+	csv := "time,rpcNode,curSlot,finalizedSlot\n2021-03-01T12:00:00Z,http://node:8899,990,958\n2021-03-01T12:00:10Z,http://node:8899,1000,968\n"
+	rounds, _, err := readWatchCSV(strings.NewReader(csv), "")
+	if err != nil || len(rounds) != 2 || rounds[1].LoadFailure != "" || rounds[1].Target.CurrentSlot != 1000 || rounds[1].Target.FinalizedSlot != 968 {
+		t.Errorf("unexpected rounds %+v (%v)", rounds, err)
+	}
+}
+
+func TestReadWatchCSVErrors(t *testing.T) {
+	tests := map[string]string{
+		"time,rpcNode,curSlot\n2021-03-01T12:00:00Z,http://node:8899,many\n":    "line 2: invalid curSlot",
+		"time,rpcNode\nyesterday,http://node:8899\n":                            "line 2: invalid time",
+		"rpcNode,curSlot\nhttp://node:8899,990\n":                               "line 2: the time column is needed",
+		"time,curSlot\n2021-03-01T12:00:00Z,990\n":                              "line 2: the rpcNode column is needed",
+		"time,rpcNode,hasErrors\n2021-03-01T12:00:00Z,http://node:8899,maybe\n": "line 2:",
+	}
+	for csv, message := range tests {
+		if _, _, err := readWatchCSV(strings.NewReader(csv), ""); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q: got %v, want %q", csv, err, message)
+		}
+	}
+}
+
+func TestLoadRounds(t *testing.T) {
+	dir := t.TempDir()
+	snapshotLog := filepath.Join(dir, "snapshots.ndjson")
+	ndjson := `{"time":"2021-03-01T12:00:00Z","target":{"rpcNode":"http://node:8899","currentSlot":990},"references":[{"rpcNode":"http://ref:8899","currentSlot":1000}]}
+
+{"time":"2021-03-01T12:00:10Z","target":{"rpcNode":""},"references":null,"loadFailure":"loadinghc"}
+`
+	if err := ioutil.WriteFile(snapshotLog, []byte(ndjson), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rounds, target, err := LoadRounds(snapshotLog, "")
+	if err != nil || target != "http://node:8899" || len(rounds) != 2 {
+		t.Fatalf("got %+v for %s (%v)", rounds, target, err)
+	}
+	if rounds[0].Target.CurrentSlot != 990 || len(rounds[0].References) != 1 || rounds[1].LoadFailure != "loadinghc" || rounds[1].Target != nil {
+		t.Errorf("unexpected rounds %+v", rounds)
+	}
+
+	watchLog := filepath.Join(dir, "watch.csv")
+	if err := ioutil.WriteFile(watchLog, []byte("time,rpcNode,curSlot\n2021-03-01T12:00:00Z,http://node:8899,990\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rounds, target, err = LoadRounds(watchLog, ""); err != nil || target != "http://node:8899" || len(rounds) != 1 {
+		t.Errorf("got %+v for %s from the csv (%v)", rounds, target, err)
+	}
+
+	broken := filepath.Join(dir, "broken.ndjson")
+	if err := ioutil.WriteFile(broken, []byte("{\"time\":\"2021-03-01T12:00:00Z\"}\n{\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadRounds(broken, ""); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got %v for a broken snapshot log", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/linuskendall/solana-rpc-health-check/health-check/simulation"
+)
+
+// Repeatable -candidate flag
+type candidateList []string
+
+func (l *candidateList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *candidateList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+var (
+	candidates candidateList
+	base       = flag.String("base", "", "Check options of the agent that recorded the log, e.g. \"slot-diff=200 up=2 down=4 blocks=true\"")
+	dampening  = flag.String("dampening", "", "Enable flap dampening for all configs with these options, e.g. \"half-life=15m\"")
+	target     = flag.String("target", "", "Rpc uri of the target in a csv log (default the first node)")
+	flapWindow = flag.Duration("flap-window", 10*time.Minute, "Outages shorter than this count as flaps")
+	events     = flag.Bool("events", false, "List the outages of every config")
+	verbose    = flag.Bool("v", false, "Print the log of the health check")
+)
+
+func init() {
+	flag.Var(&candidates, "candidate", "Check options to compare against the base, replacing the base's values; can be repeated")
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [flags] log\n\n", os.Args[0])
+	fmt.Fprintln(out, "Re-evaluates a -snapshot-log of the haproxy agent or the csv output of csv-health-check -watch with other check configs,")
+	fmt.Fprintln(out, "and reports the transitions, downtime and flaps each config would have produced.")
+	fmt.Fprintln(out, "The check options are slot-diff, block-diff, up, down, ledger, blocks, retransmit, genesis, health, fork, accounts, stall, block-age, processed-gap, stale and levels.")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	rounds, targetUri, err := LoadRounds(flag.Arg(0), *target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "couldn't read the log: ", err)
+		os.Exit(1)
+	}
+	if len(rounds) == 0 {
+		fmt.Fprintln(os.Stderr, "the log has no checks")
+		os.Exit(1)
+	}
+
+	// The agent compares against references if the log has any
+	needsReferences := false
+	for _, r := range rounds {
+		needsReferences = needsReferences || len(r.References) > 0
+	}
+
+	configs := []Candidate{}
+	for _, spec := range append([]string{""}, candidates...) {
+		c := Candidate{Name: spec, Checks: simulation.DefaultChecks()}
+		if spec == "" {
+			c.Name = "base"
+		}
+		if err := c.Checks.ParseOptions(append(strings.Fields(*base), strings.Fields(spec)...)); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid options %q: %v\n", spec, err)
+			os.Exit(2)
+		}
+		if *dampening != "" {
+			if err := c.Checks.ParseDampening(strings.Fields(*dampening)); err != nil {
+				fmt.Fprintln(os.Stderr, "invalid -dampening: ", err)
+				os.Exit(2)
+			}
+		}
+		configs = append(configs, c)
+	}
+
+	span := rounds[len(rounds)-1].Time.Sub(rounds[0].Time)
+	fmt.Printf("%d checks of %s from %s over %s\n\n", len(rounds), targetUri, rounds[0].Time.Format(time.RFC3339), span.Round(time.Second))
+
+	reports := []Report{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "config\ttransitions\tdowntime\tdrained\toutages\tflaps")
+	for _, c := range configs {
+		r := Analyze(c, rounds, targetUri, needsReferences, *flapWindow)
+		reports = append(reports, r)
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%d\n", r.Candidate, r.Transitions, r.Downtime.Round(time.Second), r.DrainTime.Round(time.Second), len(r.Outages), r.Flaps)
+	}
+	w.Flush()
+
+	if !*events {
+		return
+	}
+	for _, r := range reports {
+		fmt.Printf("\n%s:\n", r.Candidate)
+		for _, o := range r.Outages {
+			line := fmt.Sprintf("  %s  %-5s %-10s #%s", o.Start.Format(time.RFC3339), o.Status, o.Duration.Round(time.Second), o.Reason)
+			if o.Ongoing {
+				line += " (ongoing)"
+			} else if o.Flap {
+				line += " (flap)"
+			}
+			fmt.Println(line)
+		}
+	}
+}
@@ -3,8 +3,10 @@ module github.com/linuskendall/solana-rpc-health-check
 go 1.16
 
 require (
-	github.com/firstrow/tcp_server v0.1.0
+	github.com/envoyproxy/go-control-plane v0.9.9
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/linuskendall/jsonrpc/v2 v2.2.0
 	github.com/prometheus/client_golang v1.10.0
+	google.golang.org/grpc v1.36.0
+	google.golang.org/protobuf v1.25.0
 )
@@ -0,0 +1,61 @@
+package solanahc
+
+import (
+	"time"
+)
+
+// Version of the JSON API served by health-check-server, it is the prefix of every path
+const ApiVersion = "v1"
+
+// The verdict of a node as returned by the API
+type NodeStatus struct {
+	RpcUri       string        `json:"rpc"`
+	Status       Status        `json:"status"`
+	Reason       string        `json:"reason,omitempty"`
+	Alive        bool          `json:"alive"`
+	Updated      time.Time     `json:"updated"`
+	State        *NodeSnapshot `json:"state,omitempty"`
+	Checks       []CheckState  `json:"checks"`
+	LoadFailures uint64        `json:"loadFailures"`
+}
+
+// The status of a haproxy agent as returned by its /status endpoint
+type AgentStatus struct {
+	RpcUri  string   `json:"rpc"`
+	Servers []string `json:"servers"`
+	// The answer haproxy gets, with the maintenance file, overrides, drain and peer consensus applied
+	Status string `json:"status"`
+	// The verdict of the health checks alone
+	Verdict    string      `json:"verdict,omitempty"`
+	Evaluation *Evaluation `json:"evaluation,omitempty"`
+	// Set if a shadow profile is evaluated
+	Shadow              string `json:"shadow,omitempty"`
+	ShadowDisagreements uint64 `json:"shadowDisagreements,omitempty"`
+}
+
+// Sent on the watch stream after every round of evaluations
+type StatusUpdate struct {
+	Time  time.Time    `json:"time"`
+	Nodes []NodeStatus `json:"nodes"`
+}
+
+func NewNodeStatus(s *HealthState) NodeStatus {
+	status := NodeStatus{
+		RpcUri:       s.RpcUri,
+		Checks:       s.CheckStates(),
+		LoadFailures: s.LoadFailures(),
+	}
+	status.Status, status.Reason = s.GetVerdict()
+	status.Alive, _ = s.IsAlive()
+
+	if eval, ok := s.LastEvaluation(); ok {
+		status.Updated = eval.Time
+		if eval.Target.RpcNode != "" {
+			status.State = &eval.Target
+		}
+	}
+	if status.Checks == nil {
+		status.Checks = []CheckState{}
+	}
+	return status
+}
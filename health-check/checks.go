@@ -0,0 +1,440 @@
+package solanahc
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+// Names of the checks, these are used to configure the check levels
+const (
+	CheckNotFound    = "notfound"
+	CheckError       = "checkerror"
+	CheckBehind      = "behind"
+	CheckRetransmit  = "maxretransmit"
+	CheckSlotsStored = "slotsstored"
+	CheckBlocks      = "blocks"
+	CheckGenesis     = "genesis"
+	CheckNodeHealth  = "nodehealth"
+	CheckStalled     = "stalled"
+	CheckProcessed   = "processedgap"
+	CheckFork        = "fork"
+	CheckAccounts    = "accounts"
+	CheckBlockTime   = "blocktime"
+)
+
+// How a failing check affects the verdict, ordered from least to most severe
+type Severity int
+
+const (
+	SeverityWarn Severity = iota
+	SeverityDrain
+	SeverityDown
+	SeverityFatal
+)
+
+var severityNames = []string{"warn", "drain", "down", "fatal"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return "unknown"
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) (err error) {
+	*s, err = ParseSeverity(string(text))
+	return
+}
+
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if n == name {
+			return Severity(i), nil
+		}
+	}
+	return SeverityWarn, fmt.Errorf("unknown severity %q", name)
+}
+
+// The severity of a check and the number of consecutive results needed to change its state
+type CheckLevel struct {
+	Severity Severity `json:"severity"`
+	Rise     int      `json:"rise"`
+	Fall     int      `json:"fall"`
+}
+
+// Returns the default levels, checks go down after fall failures and up after rise passes
+func DefaultCheckLevels(rise int, fall int) map[string]CheckLevel {
+	levels := map[string]CheckLevel{}
+	for _, name := range []string{CheckError, CheckBehind, CheckRetransmit, CheckSlotsStored, CheckBlocks, CheckNodeHealth, CheckStalled, CheckProcessed, CheckFork, CheckAccounts, CheckBlockTime} {
+		levels[name] = CheckLevel{Severity: SeverityDown, Rise: rise, Fall: fall}
+	}
+	levels[CheckNotFound] = CheckLevel{Severity: SeverityFatal, Rise: rise, Fall: 1}
+	levels[CheckGenesis] = CheckLevel{Severity: SeverityFatal, Rise: rise, Fall: 1}
+	return levels
+}
+
+// Updates levels from a comma separated list of name:severity[:fall[:rise]]
+func ParseCheckLevels(spec string, levels map[string]CheckLevel) (err error) {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		if len(fields) < 2 || len(fields) > 4 {
+			return fmt.Errorf("invalid check level %q, expected name:severity[:fall[:rise]]", entry)
+		}
+
+		level, ok := levels[fields[0]]
+		if !ok {
+			return fmt.Errorf("unknown check %q", fields[0])
+		}
+
+		if level.Severity, err = ParseSeverity(fields[1]); err != nil {
+			return
+		}
+		if len(fields) > 2 {
+			if level.Fall, err = strconv.Atoi(fields[2]); err != nil || level.Fall < 1 {
+				return fmt.Errorf("invalid fall in check level %q", entry)
+			}
+		}
+		if len(fields) > 3 {
+			if level.Rise, err = strconv.Atoi(fields[3]); err != nil || level.Rise < 1 {
+				return fmt.Errorf("invalid rise in check level %q", entry)
+			}
+		}
+
+		// Fatal checks always act on the first failure
+		if level.Severity == SeverityFatal {
+			level.Fall = 1
+		}
+		levels[fields[0]] = level
+	}
+	return
+}
+
+// The outcome of a single check, Reason is reported when the check fails
+type CheckResult struct {
+	Name      string `json:"name"`
+	Reason    string `json:"reason,omitempty"`
+	Reference int64  `json:"reference"`
+	Local     int64  `json:"local"`
+	Diff      int64  `json:"diff"`
+	Threshold int64  `json:"threshold"`
+	Failed    bool   `json:"failed"`
+	// Set if the check couldn't be evaluated, the state of the check is left as it is
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+func NewCheckResult(name string, reference int64, local int64, threshold int64, failReason string) CheckResult {
+	return CheckResult{
+		Name:      name,
+		Reason:    failReason,
+		Reference: reference,
+		Local:     local,
+		Diff:      local - reference,
+		Threshold: threshold,
+		Failed:    failReason != "",
+	}
+}
+
+// A check that couldn't be evaluated in this round, the reason says why
+func NewSkippedResult(name string, reason string) CheckResult {
+	return CheckResult{Name: name, Reason: reason, Skipped: true}
+}
+
+// The healthy values that a node is compared against
+type Reference struct {
+	Slot          solanarpc.Slot `json:"slot"`
+	PrevMaxBlocks int            `json:"prevMaxBlocks"`
+	CurMaxBlocks  int            `json:"curMaxBlocks"`
+	GenesisHash   string         `json:"genesisHash,omitempty"`
+	// How long the slot of the target hasn't advanced
+	StalledFor time.Duration `json:"stalledFor"`
+	// How old the latest block of the target is, by the local clock
+	BlockAge time.Duration `json:"blockAge"`
+	// The blockhash most references have at the slot compared by the fork check
+	BlockhashSlot solanarpc.Slot `json:"blockhashSlot,omitempty"`
+	Blockhash     string         `json:"blockhash,omitempty"`
+	// The account hashes most references have at the slots the target read the accounts at
+	Accounts map[string]AccountHash `json:"accounts,omitempty"`
+}
+
+// Which checks are run and their thresholds
+type CheckConfig struct {
+	MaxSlotDiff       int  `json:"maxSlotDiff"`
+	MaxBlockDiff      int  `json:"maxBlockDiff"`
+	MinimumLedgerSize int  `json:"minimumLedgerSize"`
+	RetransmitCheck   bool `json:"retransmitCheck"`
+	BlockCheck        bool `json:"blockCheck"`
+	GenesisCheck      bool `json:"genesisCheck"`
+	HealthCheck       bool `json:"healthCheck"`
+	// Seconds without a new slot after which the node is stalled, 0 to disable
+	MaxStallSeconds int `json:"maxStallSeconds"`
+	// Maximum number of slots the processed slot may be ahead of the confirmed one, 0 to disable
+	MaxProcessedGap int  `json:"maxProcessedGap"`
+	ForkCheck       bool `json:"forkCheck"`
+	// Accounts whose data is compared with the references
+	Accounts []string `json:"accounts"`
+	// Maximum age in seconds of the block at the current slot, 0 to disable
+	MaxBlockAgeSeconds int `json:"maxBlockAgeSeconds"`
+}
+
+// Runs the enabled checks of the target against the reference, the reference
+// comparisons are only done when there are reference states
+func (c *CheckConfig) Run(target *NodeSnapshot, references []NodeSnapshot, ref Reference) (results []CheckResult) {
+	if len(references) > 0 {
+		compareCurrentSlot := int64(target.CurrentSlot - ref.Slot)
+		log.Println("***", "compareCurrentSlot: remote=", ref.Slot, "local=", target.CurrentSlot, "diff=", compareCurrentSlot)
+
+		var reason string
+		if compareCurrentSlot < -int64(c.MaxSlotDiff) {
+			log.Println("node is unhealthy, it is more than ", c.MaxSlotDiff, " slots behind")
+			reason = "behind"
+		}
+		results = append(results, NewCheckResult(CheckBehind, int64(ref.Slot), int64(target.CurrentSlot), int64(c.MaxSlotDiff), reason))
+	}
+
+	// A failed lookup of the genesis hash is inconclusive, the check keeps its state
+	if c.GenesisCheck && len(references) > 0 && ref.GenesisHash != "" && target.GenesisHash != "" {
+		log.Println("***", "checkGenesis: remote=", ref.GenesisHash, "local=", target.GenesisHash)
+
+		var reason string
+		if target.GenesisHash != ref.GenesisHash {
+			log.Println("node is unhealthy, it is on a different cluster than the references")
+			reason = "wrongcluster"
+		}
+		results = append(results, NewCheckResult(CheckGenesis, 0, 0, 0, reason))
+	}
+
+	// Emitted every round, a round without a common block passes so that the check
+	// doesn't start out active whenever a block can be compared again
+	if c.ForkCheck && len(references) > 0 {
+		log.Println("***", "checkFork: slot=", ref.BlockhashSlot, "remote=", ref.Blockhash, "local=", target.Blockhash)
+
+		comparable := ref.Blockhash != "" && target.Blockhash != "" && target.BlockhashSlot == ref.BlockhashSlot
+		var reason string
+		if comparable && target.Blockhash != ref.Blockhash {
+			log.Println("node is unhealthy, its block at slot ", ref.BlockhashSlot, " differs from the references")
+			reason = "fork"
+		}
+		results = append(results, NewCheckResult(CheckFork, int64(ref.BlockhashSlot), int64(target.BlockhashSlot), 0, reason))
+	}
+
+	if len(c.Accounts) > 0 && len(references) > 0 {
+		compared, matching := 0, 0
+		for _, account := range c.Accounts {
+			local, ok := target.Accounts[account]
+			remote, ok2 := ref.Accounts[account]
+			if !ok || !ok2 || local.Slot != remote.Slot {
+				continue
+			}
+			compared++
+			if local.Hash == remote.Hash {
+				matching++
+			} else {
+				log.Println("node is unhealthy, account ", account, " differs from the references at slot ", local.Slot)
+			}
+		}
+		log.Println("***", "checkAccounts: compared=", compared, "matching=", matching)
+
+		// Accounts are only compared when a reference read them at the same slot, a round
+		// without any neither passes nor fails
+		var reason string
+		if matching < compared {
+			reason = "accounts"
+		}
+		if compared == 0 {
+			log.Println("no account was read at the same slot as the references, skipping the check")
+			results = append(results, NewSkippedResult(CheckAccounts, "noslot"))
+		} else {
+			results = append(results, NewCheckResult(CheckAccounts, int64(compared), int64(matching), 0, reason))
+		}
+	}
+
+	// Needs no references, the node compares itself against the cluster
+	if c.HealthCheck && target.Health != nil {
+		var behind int64
+		if target.Health.NumSlotsBehind != nil {
+			behind = int64(*target.Health.NumSlotsBehind)
+		}
+		log.Println("***", "checkNodeHealth: healthy=", target.Health.Healthy, "behind=", behind, "message=", target.Health.Message)
+
+		var reason string
+		if !target.Health.Healthy {
+			log.Println("node is unhealthy, it reports: ", target.Health.Message)
+			reason = "nodehealth"
+			if target.Health.NumSlotsBehind != nil {
+				reason = fmt.Sprintf("nodehealth,behind=%d", behind)
+			}
+		}
+		results = append(results, NewCheckResult(CheckNodeHealth, 0, -behind, 0, reason))
+	}
+
+	if c.MaxStallSeconds > 0 {
+		stalled := int64(ref.StalledFor / time.Second)
+		log.Println("***", "checkStalled: slot=", target.CurrentSlot, "unchanged for=", ref.StalledFor)
+
+		var reason string
+		if stalled >= int64(c.MaxStallSeconds) {
+			log.Println("node is unhealthy, it has had no new slot for ", ref.StalledFor)
+			reason = "stalled"
+		}
+		results = append(results, NewCheckResult(CheckStalled, 0, stalled, int64(c.MaxStallSeconds), reason))
+	}
+
+	// A node without a block time near its current slot passes, the stall check catches a stuck node
+	if c.MaxBlockAgeSeconds > 0 {
+		log.Println("***", "checkBlockTime: slot=", target.CurrentSlot, "block time=", target.BlockTime, "lag=", ref.BlockAge)
+
+		// Without a block near the current slot the age of the chain view is unknown
+		if target.BlockTime == 0 {
+			log.Println("no block time near slot ", target.CurrentSlot, ", skipping the check")
+			results = append(results, NewSkippedResult(CheckBlockTime, "noblocktime"))
+		} else {
+			lag := int64(ref.BlockAge / time.Second)
+			var reason string
+			if lag > int64(c.MaxBlockAgeSeconds) {
+				log.Println("node is unhealthy, its latest block is more than ", c.MaxBlockAgeSeconds, " seconds old")
+				reason = fmt.Sprintf("blocktime,lag=%ds", lag)
+			}
+			results = append(results, NewCheckResult(CheckBlockTime, 0, lag, int64(c.MaxBlockAgeSeconds), reason))
+		}
+	}
+
+	if c.MaxProcessedGap > 0 {
+		processedGap := int64(target.ProcessedSlot) - int64(target.CurrentSlot)
+		log.Println("***", "checkProcessedGap: processed=", target.ProcessedSlot, "confirmed=", target.CurrentSlot, "diff=", processedGap)
+
+		var reason string
+		if processedGap > int64(c.MaxProcessedGap) {
+			log.Println("node is unhealthy, its processed slot is more than ", c.MaxProcessedGap, " slots ahead of the confirmed slot")
+			reason = "processedgap"
+		}
+		results = append(results, NewCheckResult(CheckProcessed, int64(target.CurrentSlot), int64(target.ProcessedSlot), int64(c.MaxProcessedGap), reason))
+	}
+
+	if c.RetransmitCheck {
+		compareMaxTransmit := int64(target.CurrentSlot - target.MaxRetransmitSlot)
+		log.Println("***", "compareMaxTransmit: remote=", target.MaxRetransmitSlot, "local=", target.CurrentSlot, "diff=", compareMaxTransmit)
+
+		// The retransmit check is currently informational only
+		results = append(results, NewCheckResult(CheckRetransmit, int64(target.MaxRetransmitSlot), int64(target.CurrentSlot), int64(c.MaxSlotDiff), ""))
+	}
+
+	if c.MinimumLedgerSize > 0 {
+		slotsStored := uint64(target.CurrentSlot - target.MinimumSlot)
+		log.Println("***", "checkSlotsStored: healthy=", c.MinimumLedgerSize, "local=", slotsStored)
+
+		var reason string
+		if slotsStored < uint64(c.MinimumLedgerSize) {
+			log.Println("node is unhealthy, it does not have ", c.MinimumLedgerSize, " slots stored")
+			reason = "slotsstored"
+		}
+		results = append(results, NewCheckResult(CheckSlotsStored, int64(c.MinimumLedgerSize), int64(slotsStored), int64(c.MinimumLedgerSize), reason))
+	}
+
+	if c.BlockCheck {
+		currentEpochBlocks := target.CurEpochBlocks
+		prevEpochBlocks := target.PrevEpochBlocks
+		currentEpochBlockDiff := currentEpochBlocks - ref.CurMaxBlocks
+		prevEpochBlockDiff := prevEpochBlocks - ref.PrevMaxBlocks
+		log.Println("***", "blockCheck (current epoch): healthy=", ref.CurMaxBlocks, " local=", currentEpochBlocks, " diff=", currentEpochBlockDiff)
+		log.Println("***", "blockCheck (previous epoch): healthy=", ref.PrevMaxBlocks, " local=", prevEpochBlocks, " diff=", prevEpochBlockDiff)
+
+		var reason string
+		if currentEpochBlocks <= 0 {
+			log.Println("node is unhealthy, there are holes in the current epoch block records")
+			reason = "holes"
+		} else if currentEpochBlockDiff < -c.MaxBlockDiff || currentEpochBlockDiff > c.MaxBlockDiff {
+			log.Println("node is unhealthy, there is a difference of ", currentEpochBlockDiff, " which is more than ", c.MaxBlockDiff)
+			reason = "blockdiff"
+		}
+		results = append(results, NewCheckResult(CheckBlocks, int64(ref.CurMaxBlocks), int64(currentEpochBlocks), int64(c.MaxBlockDiff), reason))
+	}
+
+	return
+}
+
+// Computes the reference from the highest values seen on the target and the references
+func NewReference(target NodeSnapshot, references []NodeSnapshot) (ref Reference) {
+	for _, state := range append([]NodeSnapshot{target}, references...) {
+		if state.CurrentSlot > ref.Slot {
+			ref.Slot = state.CurrentSlot
+		}
+		if state.PrevEpochBlocks > ref.PrevMaxBlocks {
+			ref.PrevMaxBlocks = state.PrevEpochBlocks
+		}
+		if state.CurEpochBlocks > ref.CurMaxBlocks {
+			ref.CurMaxBlocks = state.CurEpochBlocks
+		}
+	}
+	ref.GenesisHash = GenesisMajority(references)
+	ref.BlockhashSlot = target.BlockhashSlot
+	ref.Blockhash = BlockhashMajority(references, target.BlockhashSlot)
+	for account, local := range target.Accounts {
+		if hash := AccountMajority(references, account, local.Slot); hash != "" {
+			if ref.Accounts == nil {
+				ref.Accounts = map[string]AccountHash{}
+			}
+			ref.Accounts[account] = AccountHash{Slot: local.Slot, Hash: hash}
+		}
+	}
+	return
+}
+
+// Returns the hash of the account at slot reported by most of the states
+func AccountMajority(states []NodeSnapshot, account string, slot solanarpc.Slot) (hash string) {
+	counts := map[string]int{}
+	for _, state := range states {
+		a, ok := state.Accounts[account]
+		if !ok || a.Slot != slot {
+			continue
+		}
+		counts[a.Hash]++
+		if counts[a.Hash] > counts[hash] {
+			hash = a.Hash
+		}
+	}
+	return
+}
+
+// Returns the blockhash at slot reported by most of the states
+func BlockhashMajority(states []NodeSnapshot, slot solanarpc.Slot) (blockhash string) {
+	counts := map[string]int{}
+	for _, state := range states {
+		if state.Blockhash == "" || state.BlockhashSlot != slot {
+			continue
+		}
+		counts[state.Blockhash]++
+		if counts[state.Blockhash] > counts[blockhash] {
+			blockhash = state.Blockhash
+		}
+	}
+	return
+}
+
+// Returns the genesis hash reported by most of the states
+func GenesisMajority(states []NodeSnapshot) (genesisHash string) {
+	counts := map[string]int{}
+	for _, state := range states {
+		if state.GenesisHash == "" {
+			continue
+		}
+		counts[state.GenesisHash]++
+		if counts[state.GenesisHash] > counts[genesisHash] {
+			genesisHash = state.GenesisHash
+		}
+	}
+	return
+}
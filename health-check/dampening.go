@@ -0,0 +1,103 @@
+package solanahc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Route flap dampening as used for BGP: every transition to down adds a penalty which
+// decays exponentially with the half life. A node whose penalty exceeds the suppress
+// threshold is held down until the penalty has decayed below the reuse threshold.
+type Dampener struct {
+	HalfLife          time.Duration
+	MaxSuppress       time.Duration
+	Penalty           float64
+	SuppressThreshold float64
+	ReuseThreshold    float64
+	FlapWindow        time.Duration
+
+	mu          sync.Mutex
+	penalty     float64
+	updated     time.Time
+	suppressed  bool
+	transitions []time.Time
+}
+
+type DampeningState struct {
+	Penalty    float64 `json:"penalty"`
+	Suppressed bool    `json:"suppressed"`
+	Flaps      int     `json:"flaps"`
+}
+
+func NewDampener(penalty, suppress, reuse float64, halfLife, maxSuppress, flapWindow time.Duration) *Dampener {
+	return &Dampener{
+		HalfLife:          halfLife,
+		MaxSuppress:       maxSuppress,
+		Penalty:           penalty,
+		SuppressThreshold: suppress,
+		ReuseThreshold:    reuse,
+		FlapWindow:        flapWindow,
+	}
+}
+
+// The penalty above which a node would stay suppressed for longer than MaxSuppress
+func (d *Dampener) ceiling() float64 {
+	return d.ReuseThreshold * math.Pow(2, float64(d.MaxSuppress)/float64(d.HalfLife))
+}
+
+// Decays the penalty and updates the suppressed flag, must be called with mu held
+func (d *Dampener) decay(now time.Time) {
+	if !d.updated.IsZero() && d.HalfLife > 0 {
+		elapsed := now.Sub(d.updated)
+		d.penalty = d.penalty * math.Pow(0.5, float64(elapsed)/float64(d.HalfLife))
+	}
+	d.updated = now
+
+	if d.suppressed && d.penalty < d.ReuseThreshold {
+		d.suppressed = false
+	}
+
+	// Forget transitions outside the flap window
+	i := 0
+	for i < len(d.transitions) && now.Sub(d.transitions[i]) > d.FlapWindow {
+		i++
+	}
+	d.transitions = d.transitions[i:]
+}
+
+// Records a change of status, only transitions to down are penalised
+func (d *Dampener) Transition(now time.Time, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.decay(now)
+	d.transitions = append(d.transitions, now)
+
+	if down {
+		d.penalty = math.Min(d.penalty+d.Penalty, d.ceiling())
+		if d.penalty >= d.SuppressThreshold {
+			d.suppressed = true
+		}
+	}
+}
+
+func (d *Dampener) Suppressed(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.decay(now)
+	return d.suppressed
+}
+
+func (d *Dampener) State(now time.Time) DampeningState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.decay(now)
+	return DampeningState{
+		Penalty:    d.penalty,
+		Suppressed: d.suppressed,
+		Flaps:      len(d.transitions),
+	}
+}
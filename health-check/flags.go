@@ -0,0 +1,120 @@
+package solanahc
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+// The flags configuring the checks, registered the same way by every command running them
+type CheckFlags struct {
+	MaxSlotDiff       *int
+	MaxBlockDiff      *int
+	UpThreshold       *int
+	DownThreshold     *int
+	BlockCheck        *bool
+	RetransmitCheck   *bool
+	GenesisCheck      *bool
+	ForkCheck         *bool
+	Accounts          *string
+	HealthCheck       *bool
+	MaxStallTime      *time.Duration
+	MaxProcessedGap   *int
+	MaxBlockAge       *time.Duration
+	MinimumLedgerSize *int
+	CheckLevels       *string
+	ReferenceServers  *string
+}
+
+func RegisterCheckFlags(fs *flag.FlagSet) *CheckFlags {
+	return &CheckFlags{
+		MaxSlotDiff:       fs.Int("slot-diff", 200, "Maximum divergence in slots"),
+		MaxBlockDiff:      fs.Int("block-diff", 300, "Maximum divergence in blocks"),
+		UpThreshold:       fs.Int("up", 2, "Number of consecutive health checks that report up before node is healthy (default rise of every check)"),
+		DownThreshold:     fs.Int("down", 4, "Number of consecutive health checks that report down before node is unhealthy (default fall of every check)"),
+		BlockCheck:        fs.Bool("enable-block-check", false, "Enable checking block storage for consecutive blocks (expensive)"),
+		RetransmitCheck:   fs.Bool("enable-max-retransmit-check", true, "Enable checking max retransmit slots"),
+		GenesisCheck:      fs.Bool("enable-genesis-check", true, "Enable checking that the node is on the same cluster as the reference servers"),
+		ForkCheck:         fs.Bool("enable-fork-check", false, "Enable comparing the hash of a recent rooted block with the reference servers to detect a node on a minority fork"),
+		Accounts:          fs.String("accounts", "", "Comma separated list of accounts whose data is compared with the reference servers, e.g. Config1111111111111111111111111111111111111 (accounts that change every slot, like the Clock sysvar, are only compared when the nodes read them at the same slot)"),
+		HealthCheck:       fs.Bool("enable-health-check", false, "Enable checking the health the node reports itself with getHealth, this needs no reference servers"),
+		MaxStallTime:      fs.Duration("stall-time", 0, "Time without a new slot after which the node is stalled, this needs no reference servers (0 to disable)"),
+		MaxProcessedGap:   fs.Int("processed-gap", 0, "Maximum number of slots the processed slot may be ahead of the confirmed slot (0 to disable)"),
+		MaxBlockAge:       fs.Duration("max-block-age", 0, "Maximum age of the block at the current slot by the local clock, this needs no reference servers (0 to disable)"),
+		MinimumLedgerSize: fs.Int("minimum-ledger-size", 0, "Minimum number of slots that node needs to have stored"),
+		CheckLevels:       fs.String("check-levels", "", "Comma separated list of name:severity[:fall[:rise]] overriding the severity (fatal, down, drain or warn) and thresholds of single checks"),
+		ReferenceServers:  fs.String("reference-servers", "", "Enables checking the current slot against provided comma separated list of reference servers"),
+	}
+}
+
+// Splits a comma separated flag value, dropping the whitespace around the items and empty items
+func SplitList(list string) (items []string) {
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+func (f *CheckFlags) Config() CheckConfig {
+	return CheckConfig{
+		MaxSlotDiff:        *f.MaxSlotDiff,
+		MaxBlockDiff:       *f.MaxBlockDiff,
+		MinimumLedgerSize:  *f.MinimumLedgerSize,
+		RetransmitCheck:    *f.RetransmitCheck,
+		BlockCheck:         *f.BlockCheck,
+		GenesisCheck:       *f.GenesisCheck,
+		ForkCheck:          *f.ForkCheck,
+		Accounts:           SplitList(*f.Accounts),
+		HealthCheck:        *f.HealthCheck,
+		MaxStallSeconds:    int(f.MaxStallTime.Seconds()),
+		MaxProcessedGap:    *f.MaxProcessedGap,
+		MaxBlockAgeSeconds: int(f.MaxBlockAge.Seconds()),
+	}
+}
+
+// Returns the default check levels with -check-levels applied, and the level of checks not in them
+func (f *CheckFlags) Levels() (levels map[string]CheckLevel, fallback CheckLevel, err error) {
+	levels = DefaultCheckLevels(*f.UpThreshold, *f.DownThreshold)
+	if err = ParseCheckLevels(*f.CheckLevels, levels); err != nil {
+		return nil, fallback, err
+	}
+	fallback = CheckLevel{Severity: SeverityDown, Rise: *f.UpThreshold, Fall: *f.DownThreshold}
+	return
+}
+
+func (f *CheckFlags) References() []string {
+	return SplitList(*f.ReferenceServers)
+}
+
+// The flap dampening flags
+type DampeningFlags struct {
+	Enabled     *bool
+	Penalty     *float64
+	Suppress    *float64
+	Reuse       *float64
+	HalfLife    *time.Duration
+	MaxSuppress *time.Duration
+	FlapWindow  *time.Duration
+}
+
+func RegisterDampeningFlags(fs *flag.FlagSet) *DampeningFlags {
+	return &DampeningFlags{
+		Enabled:     fs.Bool("enable-dampening", false, "Enable flap dampening, a node that keeps going down is held down until it has been stable"),
+		Penalty:     fs.Float64("dampening-penalty", 1000, "Penalty added every time the node goes down"),
+		Suppress:    fs.Float64("dampening-suppress", 2000, "Penalty above which the node is held down"),
+		Reuse:       fs.Float64("dampening-reuse", 750, "Penalty below which a held down node may come up again"),
+		HalfLife:    fs.Duration("dampening-half-life", 15*time.Minute, "Time after which the penalty has decayed by half"),
+		MaxSuppress: fs.Duration("dampening-max-suppress", time.Hour, "Maximum time a node is held down by dampening"),
+		FlapWindow:  fs.Duration("flap-window", 10*time.Minute, "Window in which status transitions are counted as flaps"),
+	}
+}
+
+// Returns nil if dampening isn't enabled
+func (f *DampeningFlags) Dampener() *Dampener {
+	if !*f.Enabled {
+		return nil
+	}
+	return NewDampener(*f.Penalty, *f.Suppress, *f.Reuse, *f.HalfLife, *f.MaxSuppress, *f.FlapWindow)
+}
@@ -0,0 +1,405 @@
+package solanahc
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+type Status string
+
+const (
+	StatusUp    = Status("up")
+	StatusDown  = Status("down")
+	StatusDrain = Status("drain")
+)
+
+// Formats a status the way the haproxy agent answers, e.g. "down #behind"
+func FormatStatus(status Status, reason string) string {
+	if reason != "" {
+		return string(status) + " #" + reason
+	}
+	return string(status)
+}
+
+// Everything that went into a single evaluation of a target
+type Evaluation struct {
+	Time         time.Time       `json:"time"`
+	Target       NodeSnapshot    `json:"target"`
+	References   []NodeSnapshot  `json:"references"`
+	Reference    Reference       `json:"reference"`
+	Checks       []CheckResult   `json:"checks"`
+	CheckStates  []CheckState    `json:"checkStates"`
+	LoadFailure  string          `json:"loadFailure,omitempty"`
+	Status       string          `json:"status"`
+	LoadFailures uint64          `json:"loadFailures"`
+	Dampening    *DampeningState `json:"dampening,omitempty"`
+	// The answer of the shadow configuration and whether its status differs from the live one
+	Shadow        string `json:"shadow,omitempty"`
+	ShadowDiffers bool   `json:"shadowDiffers,omitempty"`
+}
+
+// Number of evaluations a new HealthState keeps in its history
+const DefaultHistorySize = 100
+
+// The health verdict of a single node, updated with the results of every evaluation
+type HealthState struct {
+	// These are never changed once the state is in use
+	RpcUri string
+	Config CheckConfig
+	// Optional flap dampening, nil if disabled
+	Dampener *Dampener
+	// Additional check profiles, evaluated on the same node states
+	Profiles map[string]*ProfileState
+	// Optional configuration evaluated on the same node states which never affects the verdict
+	Shadow *ProfileState
+	// Number of evaluations kept in the history, 0 keeps all of them
+	HistorySize int
+	// Number of consecutive load failures after which the node is stale
+	StaleAfter uint64
+	// Returns the current time, time.Now if nil. Set for simulations.
+	Clock func() time.Time
+
+	// Ms is the status mutex
+	ms            sync.RWMutex
+	last_failure  string
+	status        Status
+	load_failures uint64
+	tracker       *CheckTracker
+
+	shadow_disagreements uint64
+
+	// The last slot of the target and when it changed, for the stall check
+	stall_slot  solanarpc.Slot
+	stall_since time.Time
+
+	// Mh is the history mutex
+	mh      sync.RWMutex
+	history []Evaluation
+}
+
+func NewHealthState(rpcUri string, config CheckConfig, levels map[string]CheckLevel, fallback CheckLevel) *HealthState {
+	return &HealthState{
+		RpcUri:      rpcUri,
+		Config:      config,
+		Profiles:    map[string]*ProfileState{},
+		HistorySize: DefaultHistorySize,
+		StaleAfter:  3,
+		status:      StatusDown,
+		tracker:     NewCheckTracker(levels, fallback),
+	}
+}
+
+func (s *HealthState) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+// Evaluates the target against the references, target is nil if it couldn't be loaded.
+// If needsReferences is set the evaluation fails when there are no references.
+func (s *HealthState) Evaluate(target *NodeSnapshot, references []NodeSnapshot, needsReferences bool) {
+	eval := Evaluation{
+		Time:       s.now(),
+		References: references,
+	}
+	if target != nil {
+		eval.Target = *target
+	}
+	defer s.recordEvaluation(&eval)
+
+	// Reset load failures counter
+	atomic.StoreUint64(&s.load_failures, 0)
+
+	log.Println("number of states: ", len(references))
+
+	// Check that we have at least one node to compare to
+	// in case the user has provided reference servers
+	if needsReferences && len(references) < 1 {
+		log.Println("insufficient comparison states loaded")
+		eval.LoadFailure = "lacksstates"
+		s.RegisterLoadFailure("lacksstates")
+		return
+	}
+
+	// If we can't actually load the node, lets register it down immediately
+	if target == nil {
+		log.Println("error server not found")
+		eval.Checks = []CheckResult{NewCheckResult(CheckNotFound, 0, 0, 0, "notfound")}
+		s.registerAll(eval.Checks)
+		return
+	}
+
+	// If it has an error, maybe register immediately? Not certain.
+	if target.HasErrors {
+		log.Println("error couldn't load the current rpc state")
+		eval.Checks = []CheckResult{NewCheckResult(CheckError, 0, 0, 0, "checkerror")}
+		s.registerAll(eval.Checks)
+		return
+	}
+
+	eval.Reference = NewReference(*target, references)
+	eval.Reference.StalledFor = s.stalledFor(target.CurrentSlot, eval.Time)
+	if target.BlockTime > 0 {
+		eval.Reference.BlockAge = BlockAge(target.BlockTime, eval.Time)
+	}
+
+	log.Println("**", "checking the health status of: ", target.RpcNode)
+
+	available := []CheckResult{
+		NewCheckResult(CheckNotFound, 0, 0, 0, ""),
+		NewCheckResult(CheckError, 0, 0, 0, ""),
+	}
+	eval.Checks = append(available, s.Config.Run(target, references, eval.Reference)...)
+	s.RegisterResults(eval.Checks)
+
+	for name, p := range s.Profiles {
+		log.Println("**", "checking profile: ", name)
+		p.RegisterResults(append(available, p.Config.Run(target, references, eval.Reference)...))
+	}
+
+	if s.Shadow != nil {
+		log.Println("**", "checking shadow: ", s.Shadow.Name)
+		s.Shadow.RegisterResults(append(available, s.Shadow.Config.Run(target, references, eval.Reference)...))
+	}
+}
+
+// Returns how long the slot has been unchanged, evaluations are sequential
+func (s *HealthState) stalledFor(slot solanarpc.Slot, now time.Time) time.Duration {
+	if slot != s.stall_slot || s.stall_since.IsZero() {
+		s.stall_slot = slot
+		s.stall_since = now
+	}
+	return now.Sub(s.stall_since)
+}
+
+// Returns how long before now a block was produced, blocks from the future are 0 old
+func BlockAge(blockTime int64, now time.Time) time.Duration {
+	age := now.Sub(time.Unix(blockTime, 0))
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// Registers a failure to load the node states as an evaluation
+func (s *HealthState) EvaluateLoadFailure(failure string) {
+	s.RegisterLoadFailure(failure)
+	s.recordEvaluation(&Evaluation{Time: s.now(), LoadFailure: failure})
+}
+
+// Registers results which apply to every profile
+func (s *HealthState) registerAll(results []CheckResult) {
+	s.RegisterResults(results)
+	for _, p := range s.Profiles {
+		p.RegisterResults(results)
+	}
+	if s.Shadow != nil {
+		s.Shadow.RegisterResults(results)
+	}
+}
+
+func (s *HealthState) RegisterLoadFailure(failure string) {
+	log.Println("load failure", failure)
+
+	s.ms.Lock()
+	s.last_failure = failure
+	s.ms.Unlock()
+
+	atomic.AddUint64(&s.load_failures, 1)
+}
+
+// Feeds a status change into the flap dampening
+func (s *HealthState) registerTransition(down bool) {
+	if s.Dampener != nil {
+		s.Dampener.Transition(s.now(), down)
+	}
+}
+
+// Registers the check results and updates the status from the most severe active check
+func (s *HealthState) RegisterResults(results []CheckResult) {
+	s.ms.Lock()
+	s.tracker.Register(results)
+	status, reason := trackerVerdict(s.tracker)
+
+	// A flapping node is held down until its penalty has decayed
+	if status != StatusDown && s.status == StatusDown && s.Dampener != nil && s.Dampener.Suppressed(s.now()) {
+		log.Println("node is dampened, holding it down")
+		status = StatusDown
+	}
+
+	previous := s.status
+	s.status = status
+	s.last_failure = reason
+	s.ms.Unlock()
+
+	log.Println("registering ", status, " reason=", reason)
+	if previous != status {
+		log.Println("status changed from ", previous, " to ", status)
+		s.registerTransition(status == StatusDown)
+	}
+}
+
+func (s *HealthState) IsStale() bool {
+	if atomic.LoadUint64(&s.load_failures) > s.StaleAfter {
+		return true
+	} else {
+		return false
+	}
+}
+
+func (s *HealthState) LoadFailures() uint64 {
+	return atomic.LoadUint64(&s.load_failures)
+}
+
+// Returns the current status and the reason for it
+func (s *HealthState) GetVerdict() (status Status, reason string) {
+	if s.IsStale() {
+		return StatusDown, "stale"
+	}
+
+	s.ms.RLock()
+	defer s.ms.RUnlock()
+
+	status = s.status
+	reason = s.last_failure
+	if status == "" {
+		status = StatusDown
+	}
+
+	if status == StatusDown && s.Dampener != nil {
+		if d := s.Dampener.State(s.now()); d.Suppressed {
+			if reason != "" {
+				reason += ","
+			}
+			reason += fmt.Sprintf("dampened,penalty=%.0f", math.Round(d.Penalty))
+		}
+	}
+	return
+}
+
+// Returns the verdict of a profile, ok is false if there is no such profile
+func (s *HealthState) GetProfileVerdict(name string) (status Status, reason string, ok bool) {
+	p, ok := s.Profiles[name]
+	if !ok {
+		return
+	}
+	if s.IsStale() {
+		return StatusDown, "stale", true
+	}
+	status, reason = p.GetVerdict()
+	return status, reason, true
+}
+
+// Returns the verdict of the shadow configuration, ok is false if there is none
+func (s *HealthState) GetShadowVerdict() (status Status, reason string, ok bool) {
+	if s.Shadow == nil {
+		return
+	}
+	if s.IsStale() {
+		return StatusDown, "stale", true
+	}
+	status, reason = s.Shadow.GetVerdict()
+	return status, reason, true
+}
+
+// Number of evaluations after which the shadow status differed from the live one
+func (s *HealthState) ShadowDisagreements() uint64 {
+	return atomic.LoadUint64(&s.shadow_disagreements)
+}
+
+// The node is alive as long as it can be reached, even if it is unhealthy
+func (s *HealthState) IsAlive() (alive bool, reason string) {
+	if s.IsStale() {
+		return false, "stale"
+	}
+	for _, cs := range s.CheckStates() {
+		if cs.Name == CheckNotFound && cs.Failing {
+			return false, cs.Reason
+		}
+	}
+	return true, ""
+}
+
+func (s *HealthState) GetStatus() string {
+	return FormatStatus(s.GetVerdict())
+}
+
+func (s *HealthState) CheckStates() []CheckState {
+	s.ms.RLock()
+	defer s.ms.RUnlock()
+	return s.tracker.States()
+}
+
+// Returns the reasons of failing checks with warn severity, these don't affect the verdict
+func (s *HealthState) Warnings() (reasons []string) {
+	for _, cs := range s.CheckStates() {
+		if cs.Failing && cs.Severity == SeverityWarn {
+			reasons = append(reasons, cs.Reason)
+		}
+	}
+	return
+}
+
+func (s *HealthState) DampeningState() (state DampeningState, ok bool) {
+	if s.Dampener == nil {
+		return
+	}
+	return s.Dampener.State(s.now()), true
+}
+
+// Stores the evaluation together with the state it resulted in
+func (s *HealthState) recordEvaluation(eval *Evaluation) {
+	status, reason := s.GetVerdict()
+	eval.Status = FormatStatus(status, reason)
+	if shadowStatus, shadowReason, ok := s.GetShadowVerdict(); ok {
+		eval.Shadow = FormatStatus(shadowStatus, shadowReason)
+		eval.ShadowDiffers = shadowStatus != status
+		if eval.ShadowDiffers {
+			atomic.AddUint64(&s.shadow_disagreements, 1)
+		}
+	}
+	eval.CheckStates = s.CheckStates()
+	eval.LoadFailures = atomic.LoadUint64(&s.load_failures)
+	if d, ok := s.DampeningState(); ok {
+		eval.Dampening = &d
+	}
+
+	s.mh.Lock()
+	s.history = append(s.history, *eval)
+	if s.HistorySize > 0 && len(s.history) > s.HistorySize {
+		s.history = s.history[len(s.history)-s.HistorySize:]
+	}
+	s.mh.Unlock()
+}
+
+// Returns the most recent evaluation, ok is false if nothing has been evaluated yet
+func (s *HealthState) LastEvaluation() (eval Evaluation, ok bool) {
+	s.mh.RLock()
+	defer s.mh.RUnlock()
+
+	if len(s.history) == 0 {
+		return
+	}
+	return s.history[len(s.history)-1], true
+}
+
+// Returns up to n of the most recent evaluations, oldest first
+func (s *HealthState) History(n int) (history []Evaluation) {
+	s.mh.RLock()
+	defer s.mh.RUnlock()
+
+	start := 0
+	if n > 0 && n < len(s.history) {
+		start = len(s.history) - n
+	}
+	history = make([]Evaluation, len(s.history)-start)
+	copy(history, s.history[start:])
+	return
+}
@@ -0,0 +1,205 @@
+package solanahc
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Loads the node states of a set of targets and their reference servers and
+// evaluates every target against the references
+type Monitor struct {
+	References []string
+	// Also compare every target against the other targets
+	CompareTargets bool
+	// Used by the rpc clients if set, e.g. a rpc.Recorder or rpc.Replayer
+	Transport http.RoundTripper
+
+	targets []*HealthState
+
+	// Mu is the state mutex
+	mu         sync.Mutex
+	nodeStates *NodeStates
+
+	// Ms is the mutex of the latest states
+	ms     sync.RWMutex
+	latest []NodeSnapshot
+
+	ml        sync.RWMutex
+	listeners []func()
+}
+
+func NewMonitor(targets []*HealthState, references []string) *Monitor {
+	servers := []string{}
+	ledgerCheck := false
+	blockCheck := false
+	genesisCheck := false
+	healthCheck := false
+	forkCheck := false
+	blockTimeCheck := false
+	accounts := []string{}
+	seen := map[string]bool{}
+
+	// Load everything that any of the targets or their profiles needs
+	for _, t := range targets {
+		servers = append(servers, t.RpcUri)
+		configs := []CheckConfig{t.Config}
+		for _, p := range t.Profiles {
+			configs = append(configs, p.Config)
+		}
+		if t.Shadow != nil {
+			configs = append(configs, t.Shadow.Config)
+		}
+		for _, c := range configs {
+			ledgerCheck = ledgerCheck || c.MinimumLedgerSize > 0
+			blockCheck = blockCheck || c.BlockCheck
+			genesisCheck = genesisCheck || c.GenesisCheck
+			healthCheck = healthCheck || c.HealthCheck
+			forkCheck = forkCheck || c.ForkCheck
+			blockTimeCheck = blockTimeCheck || c.MaxBlockAgeSeconds > 0
+			for _, account := range c.Accounts {
+				if !seen[account] {
+					seen[account] = true
+					accounts = append(accounts, account)
+				}
+			}
+		}
+	}
+	servers = append(servers, references...)
+
+	nodeStates := NewNodeStates(servers, blockCheck, ledgerCheck)
+	nodeStates.LoadGenesisHash = genesisCheck && len(servers) > 1
+	nodeStates.LoadHealth = healthCheck
+	nodeStates.LoadBlockhash = forkCheck && len(servers) > 1
+	nodeStates.LoadBlockTime = blockTimeCheck
+	if len(servers) > 1 {
+		nodeStates.LoadAccounts = accounts
+	}
+
+	return &Monitor{
+		References: references,
+		targets:    targets,
+		nodeStates: nodeStates,
+	}
+}
+
+func (m *Monitor) Targets() []*HealthState {
+	return m.targets
+}
+
+// Returns the target with the given rpc uri, nil if there is none
+func (m *Monitor) Target(rpcUri string) *HealthState {
+	for _, t := range m.targets {
+		if t.RpcUri == rpcUri {
+			return t
+		}
+	}
+	return nil
+}
+
+// Returns the node states loaded in the last round, targets and references
+func (m *Monitor) States() []NodeSnapshot {
+	m.ms.RLock()
+	defer m.ms.RUnlock()
+	return m.latest
+}
+
+// Registers a function which is called after every round of evaluations
+func (m *Monitor) OnEvaluated(f func()) {
+	m.ml.Lock()
+	m.listeners = append(m.listeners, f)
+	m.ml.Unlock()
+}
+
+// Loads the node states once and evaluates every target
+func (m *Monitor) Check() {
+	defer m.notify()
+
+	log.Println("checking servers ", m.nodeStates.nodes)
+	m.mu.Lock()
+	m.nodeStates.MinStates = m.minStates()
+	m.nodeStates.Transport = m.Transport
+	n_states, err := m.nodeStates.LoadStates()
+	states := make([]NodeSnapshot, 0, len(m.nodeStates.States))
+	for i := range m.nodeStates.States {
+		states = append(states, m.nodeStates.States[i].Snapshot())
+	}
+	m.mu.Unlock()
+
+	m.ms.Lock()
+	m.latest = states
+	m.ms.Unlock()
+
+	if err != nil {
+		log.Println("error loading states ", err)
+		for _, t := range m.targets {
+			t.EvaluateLoadFailure("loadinghc")
+		}
+		return
+	}
+	log.Println("saved ", n_states, " states")
+
+	byNode := map[string]NodeSnapshot{}
+	for _, state := range states {
+		byNode[state.RpcNode] = state
+	}
+
+	for _, t := range m.targets {
+		var target *NodeSnapshot
+		if state, ok := byNode[t.RpcUri]; ok {
+			target = &state
+		}
+
+		nodes := append([]string{}, m.References...)
+		if m.CompareTargets {
+			for _, other := range m.targets {
+				if other != t {
+					nodes = append(nodes, other.RpcUri)
+				}
+			}
+		}
+
+		references := []NodeSnapshot{}
+		for _, node := range nodes {
+			state, ok := byNode[node]
+			if !ok {
+				continue
+			}
+			if state.HasErrors {
+				log.Println("warning! ", state.RpcNode, " has errors, ignoring it")
+				continue
+			}
+			references = append(references, state)
+		}
+
+		t.Evaluate(target, references, len(nodes) > 0)
+	}
+}
+
+// In standalone mode, without references, only the checks that need no references run
+// and a target that can't be loaded is evaluated as not found
+func (m *Monitor) minStates() int {
+	if len(m.References) > 0 || m.CompareTargets && len(m.targets) > 1 {
+		return 2
+	}
+	return 0
+}
+
+func (m *Monitor) notify() {
+	m.ml.RLock()
+	defer m.ml.RUnlock()
+	for _, f := range m.listeners {
+		f()
+	}
+}
+
+// This method continuously updates the node states
+func (m *Monitor) Run(schedule time.Duration) {
+	ticker := time.NewTicker(schedule)
+
+	for {
+		m.Check()
+		<-ticker.C
+	}
+}
@@ -2,15 +2,29 @@ package solanahc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/linuskendall/solana-rpc-health-check/rpc"
 	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
 )
 
+// The hash of an account's lamports, owner, executable flag and data at the slot it was read at
+type AccountHash struct {
+	Slot rpc.Slot `json:"slot"`
+	Hash string   `json:"hash"`
+}
+
+// The hash of an account that doesn't exist
+const AccountMissing = "missing"
+
 type NodeState struct {
 	client            *solanarpc.Client
 	RpcNode           string
@@ -27,6 +41,13 @@ type NodeState struct {
 	Epoch             solanarpc.EpochInfo
 	EpochSchedule     solanarpc.EpochSchedule
 	GenesisHash       string
+	Health            *rpc.Health
+	FinalizedSlot     rpc.Slot
+	BlockhashSlot     rpc.Slot
+	Blockhash         string
+	Accounts          map[string]AccountHash
+	BlockTime         int64
+	Latency           time.Duration
 	epochLoaded       bool
 }
 
@@ -49,7 +70,7 @@ func (state *NodeState) LoadMeta() (err error) {
 
 	if err2 != nil {
 		state.HasErrors = true
-		state.Errors = append(state.Errors, err)
+		state.Errors = append(state.Errors, err2)
 		err = err2
 	}
 
@@ -59,17 +80,36 @@ func (state *NodeState) LoadMeta() (err error) {
 
 	if err3 != nil {
 		state.HasErrors = true
-		state.Errors = append(state.Errors, err)
+		state.Errors = append(state.Errors, err3)
 		err = err3
+	} else {
+		solanarpc.EpochSchedules.SetGenesisHash(state.RpcNode, state.GenesisHash)
 	}
 
 	return
 }
 
+// Loads only the genesis hash for the genesis check, a failed lookup leaves it empty and
+// isn't counted as an error of the node
+func (state *NodeState) LoadGenesisHash() {
+	ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
+	genesisHash, err := state.client.GetGenesisHash(ctx)
+	cancel()
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	state.GenesisHash = genesisHash
+	solanarpc.EpochSchedules.SetGenesisHash(state.RpcNode, state.GenesisHash)
+}
+
 // Loads Epoch details
 func (state *NodeState) LoadEpoch() (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
+	start := time.Now()
 	state.Epoch, err = state.client.GetEpochInfo(ctx, "")
+	state.Latency = time.Since(start)
 	cancel()
 
 	if err != nil {
@@ -79,7 +119,7 @@ func (state *NodeState) LoadEpoch() (err error) {
 	}
 
 	ctx, cancel = context.WithTimeout(context.Background(), RpcTimeout)
-	state.EpochSchedule, err = state.client.GetEpochSchedule(ctx)
+	state.EpochSchedule, err = solanarpc.EpochSchedules.Get(ctx, state.client)
 	cancel()
 
 	if err != nil {
@@ -92,6 +132,129 @@ func (state *NodeState) LoadEpoch() (err error) {
 	return
 }
 
+// Loads the health the node reports about itself
+func (state *NodeState) LoadHealth() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
+	defer cancel()
+
+	health, err := state.client.GetHealth(ctx)
+	if err != nil {
+		log.Println(err)
+		state.HasErrors = true
+		state.Errors = append(state.Errors, err)
+		return
+	}
+	state.Health = &health
+	return
+}
+
+// Loads the highest rooted slot, for choosing the block compared by the fork check and
+// the slot the accounts are read at
+func (state *NodeState) LoadFinalizedSlot() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
+	defer cancel()
+
+	state.FinalizedSlot, err = state.client.GetSlot(ctx, solanarpc.CommitmentFinalized)
+	if err != nil {
+		log.Println(err)
+		state.HasErrors = true
+		state.Errors = append(state.Errors, err)
+	}
+	return
+}
+
+// Loads the hash of the block at slot, BlockhashSkipped if the node has no block there
+// and empty if it couldn't be loaded
+func (state *NodeState) LoadBlockhash(slot rpc.Slot) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
+	defer cancel()
+
+	state.BlockhashSlot = slot
+	state.Blockhash = ""
+	block, err := state.client.GetBlock(ctx, slot, solanarpc.CommitmentFinalized)
+	if solanarpc.IsSlotSkipped(err) {
+		state.Blockhash = BlockhashSkipped
+		return nil
+	}
+	if err != nil {
+		// Not counted as an error of the node, it may just not have the block anymore
+		log.Println(err)
+		return
+	}
+	state.Blockhash = block.Blockhash
+	return
+}
+
+// Loads the hashes of the accounts at minContextSlot or later, a node that hasn't reached it yet
+// is asked again up to AccountRetries times. Accounts that couldn't be loaded are left out.
+func (state *NodeState) LoadAccounts(accounts []string, minContextSlot rpc.Slot) {
+	state.Accounts = map[string]AccountHash{}
+	for _, account := range accounts {
+		var result solanarpc.AccountInfoResult
+		var err error
+		for retry := 0; ; retry++ {
+			ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
+			result, err = state.client.GetAccountInfo(ctx, account, solanarpc.CommitmentFinalized, minContextSlot)
+			cancel()
+			if !solanarpc.IsMinContextSlotNotReached(err) || retry >= AccountRetries {
+				break
+			}
+			time.Sleep(AccountRetryDelay)
+		}
+
+		if err != nil {
+			// Not counted as an error of the node, a node that is behind is caught by the other checks
+			log.Println(err)
+			continue
+		}
+		state.Accounts[account] = AccountHash{Slot: result.Context.Slot, Hash: hashAccount(result.Value)}
+	}
+}
+
+func hashAccount(account *solanarpc.AccountInfo) string {
+	if account == nil {
+		return AccountMissing
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d/%s/%t/", account.Lamports, account.Owner, account.Executable)
+	if len(account.Data) > 0 {
+		data, err := base64.StdEncoding.DecodeString(account.Data[0])
+		if err != nil {
+			// Hash the encoded data, it can still be compared
+			data = []byte(account.Data[0])
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Loads the unix time of the latest block at or up to BlockTimeSearch slots before the current
+// slot. Slots without a block are passed over, if none of them has one BlockTime is left at 0.
+func (state *NodeState) LoadBlockTime() (err error) {
+	state.BlockTime = 0
+	for n := 0; n <= BlockTimeSearch && solanarpc.Slot(n) <= state.CurrentSlot; n++ {
+		slot := state.CurrentSlot - solanarpc.Slot(n)
+		ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
+		state.BlockTime, err = state.client.GetBlockTime(ctx, slot)
+		cancel()
+
+		if solanarpc.IsSlotSkipped(err) || solanarpc.IsBlockNotAvailable(err) {
+			// Not counted as an error of the node, the slot was skipped or its block isn't there yet
+			log.Println(err)
+			state.BlockTime = 0
+			continue
+		}
+		if err != nil {
+			log.Println(err)
+			state.HasErrors = true
+			state.Errors = append(state.Errors, err)
+		}
+		return
+	}
+	log.Println("couldn't find a block time near slot ", state.CurrentSlot)
+	return nil
+}
+
 // Runs the RPC calls for a single node
 func (state *NodeState) LoadMinimumLedger() (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
@@ -128,6 +291,11 @@ func (state *NodeState) LoadBlocks() (err error) {
 		ctx, cancel := context.WithTimeout(context.Background(), RpcTimeout)
 		defer cancel()
 
+		// There's no previous epoch on a new cluster
+		if currentEpoch == 0 {
+			return
+		}
+
 		// Check if we have slots from this epoch
 		first_slot := state.EpochSchedule.GetFirstSlotInEpoch(previousEpoch)
 		last_slot := state.EpochSchedule.GetLastSlotInEpoch(previousEpoch)
@@ -194,6 +362,8 @@ func (state *NodeState) LoadBlocks() (err error) {
 	return
 }
 
+// Loads the current slot at confirmed commitment, which is ahead of the node's default of
+// finalized, together with the processed and the max retransmit slot
 func (state *NodeState) LoadSlots() (err error) {
 	rpc_errors := make(chan error, 4)
 	var waitgroup sync.WaitGroup
@@ -255,8 +425,13 @@ func (state *NodeState) LoadSlots() (err error) {
 }
 
 func NewNodeState(node string) *NodeState {
+	return NewNodeStateWithTransport(node, nil)
+}
+
+// The rpc requests go through transport if it's not nil
+func NewNodeStateWithTransport(node string, transport http.RoundTripper) *NodeState {
 	return &NodeState{
-		client:      solanarpc.NewClient(node),
+		client:      solanarpc.NewClientWithTransport(node, transport),
 		epochLoaded: false,
 		RpcNode:     node,
 	}
@@ -3,6 +3,7 @@ package solanahc
 import (
 	"errors"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 
@@ -11,13 +12,44 @@ import (
 
 var (
 	RpcTimeout = 10 * time.Second
+	// Time to wait for a node that hasn't reached the common slot of the accounts, about a slot
+	AccountRetryDelay = 400 * time.Millisecond
 )
 
+// Number of times the accounts are requested again from a node that hasn't reached the common slot
+const AccountRetries = 3
+
+// Number of slots searched back for a block when the common finalized slot was skipped
+const BlockhashSearch = 8
+
+// Number of slots searched back for a block time when the current slot was skipped or its
+// block isn't available yet
+const BlockTimeSearch = 8
+
+// The blockhash of a node that has no block at the slot
+const BlockhashSkipped = "skipped"
+
 type NodeStates struct {
-	States         []NodeState
+	States []NodeState
+	// The states of the nodes that failed to load, they are left out of States
+	Failed         []NodeState
 	nodes          []string
 	LoadBlocks     bool
 	LoadLedgerSize bool
+	LoadMeta       bool
+	// Loads the genesis hash without the rest of the meta data
+	LoadGenesisHash bool
+	LoadHealth      bool
+	LoadBlockhash   bool
+	LoadBlockTime   bool
+	// Loads the finalized slot besides the confirmed current slot
+	LoadFinalizedSlot bool
+	// Accounts compared across the nodes
+	LoadAccounts []string
+	// Number of states that have to load, 2 to compare a node against another
+	MinStates int
+	// Used by the rpc clients if set, e.g. a rpc.Recorder or rpc.Replayer
+	Transport http.RoundTripper
 }
 
 // Run a health check on a list of nodes, returnign a set of nodestates
@@ -33,14 +65,18 @@ func (ns *NodeStates) LoadStates() (n_states int, err error) {
 			waitgroup.Add(1)
 			go func(i int) {
 				defer waitgroup.Done()
-				state := NewNodeState(ns.nodes[i])
+				state := NewNodeStateWithTransport(ns.nodes[i], ns.Transport)
 
 				state.LoadEpoch()
 				if state.HasErrors {
+					st <- state
 					return
 				}
 
 				state.LoadSlots()
+				if ns.LoadBlockTime && !state.HasErrors {
+					state.LoadBlockTime()
+				}
 
 				if ns.LoadLedgerSize {
 					state.LoadMinimumLedger()
@@ -48,6 +84,17 @@ func (ns *NodeStates) LoadStates() (n_states int, err error) {
 				if ns.LoadBlocks {
 					state.LoadBlocks()
 				}
+				if ns.LoadMeta {
+					state.LoadMeta()
+				} else if ns.LoadGenesisHash {
+					state.LoadGenesisHash()
+				}
+				if ns.LoadHealth {
+					state.LoadHealth()
+				}
+				if ns.LoadFinalizedSlot || ns.LoadBlockhash || len(ns.LoadAccounts) > 0 {
+					state.LoadFinalizedSlot()
+				}
 
 				st <- state
 			}(i)
@@ -58,16 +105,25 @@ func (ns *NodeStates) LoadStates() (n_states int, err error) {
 
 		// Recreate the states
 		ns.States = make([]NodeState, 0)
+		ns.Failed = make([]NodeState, 0)
 		for s := range st {
 			if s.HasErrors {
 				log.Println("state has errors, ignoring=", s.RpcNode)
+				ns.Failed = append(ns.Failed, *s)
 			} else {
 				log.Println("loaded state=", s.RpcNode, s.CurrentSlot)
 				ns.States = append(ns.States, *s)
 			}
 		}
 
-		if len(ns.States) < 2 {
+		if ns.LoadBlockhash && len(ns.States) > 1 {
+			ns.loadBlockhashes()
+		}
+		if len(ns.LoadAccounts) > 0 && len(ns.States) > 1 {
+			ns.loadAccounts()
+		}
+
+		if len(ns.States) < ns.MinStates {
 			err = errors.New("couldn't fetch more than one node")
 		}
 	} else {
@@ -77,6 +133,58 @@ func (ns *NodeStates) LoadStates() (n_states int, err error) {
 	return
 }
 
+// Loads the hashes of the block at the highest finalized slot that every state has, going back
+// if nobody has a block at that slot
+func (ns *NodeStates) loadBlockhashes() {
+	slot := ns.States[0].FinalizedSlot
+	for _, state := range ns.States {
+		if state.FinalizedSlot < slot {
+			slot = state.FinalizedSlot
+		}
+	}
+
+	for i := 0; i < BlockhashSearch && slot > 0; i, slot = i+1, slot-1 {
+		var waitgroup sync.WaitGroup
+		for n := range ns.States {
+			waitgroup.Add(1)
+			go func(state *NodeState) {
+				defer waitgroup.Done()
+				state.LoadBlockhash(slot)
+			}(&ns.States[n])
+		}
+		waitgroup.Wait()
+
+		for _, state := range ns.States {
+			if state.Blockhash != "" && state.Blockhash != BlockhashSkipped {
+				log.Println("loaded blockhashes of slot ", slot)
+				return
+			}
+		}
+	}
+	log.Println("couldn't find a block to compare")
+}
+
+// Loads the accounts from every state at the highest finalized slot, so the nodes read them at
+// the same slot as far as possible. Only the accounts that were read at the same slot can be compared.
+func (ns *NodeStates) loadAccounts() {
+	var slot solanarpc.Slot
+	for _, state := range ns.States {
+		if state.FinalizedSlot > slot {
+			slot = state.FinalizedSlot
+		}
+	}
+
+	var waitgroup sync.WaitGroup
+	for i := range ns.States {
+		waitgroup.Add(1)
+		go func(state *NodeState) {
+			defer waitgroup.Done()
+			state.LoadAccounts(ns.LoadAccounts, slot)
+		}(&ns.States[i])
+	}
+	waitgroup.Wait()
+}
+
 // Get healthy state from a list of nodestates
 func (ns *NodeStates) GetHealthyState() (currentSlot solanarpc.Slot, prevMaxBlocks int, curMaxBlocks int, err error) {
 	if len(ns.States) < 1 {
@@ -112,5 +220,6 @@ func NewNodeStates(nodes []string, loadBlocks bool, loadLedgerSize bool) *NodeSt
 		nodes:          nodes,
 		LoadBlocks:     loadBlocks,
 		LoadLedgerSize: loadLedgerSize,
+		MinStates:      2,
 	}
 }
@@ -0,0 +1,98 @@
+package solanahc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// A profile as written in the profiles file, unset fields are taken from the command line
+type ProfileDefinition struct {
+	CheckConfig
+	// Check levels in the -check-levels format
+	Levels string `json:"levels"`
+}
+
+// An additional set of checks with their own verdict, evaluated on the same node states
+type ProfileState struct {
+	Name   string
+	Config CheckConfig
+
+	mu           sync.RWMutex
+	tracker      *CheckTracker
+	status       Status
+	last_failure string
+}
+
+func NewProfileState(name string, config CheckConfig, levels map[string]CheckLevel, fallback CheckLevel) *ProfileState {
+	return &ProfileState{
+		Name:    name,
+		Config:  config,
+		tracker: NewCheckTracker(levels, fallback),
+		status:  StatusDown,
+	}
+}
+
+func (p *ProfileState) RegisterResults(results []CheckResult) {
+	p.mu.Lock()
+	p.tracker.Register(results)
+	p.status, p.last_failure = trackerVerdict(p.tracker)
+	p.mu.Unlock()
+}
+
+func (p *ProfileState) GetVerdict() (status Status, reason string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.status, p.last_failure
+}
+
+// Maps the most severe active check to a status
+func trackerVerdict(tracker *CheckTracker) (status Status, reason string) {
+	severity, active, reasons := tracker.Verdict()
+
+	status = StatusUp
+	if active && severity >= SeverityDown {
+		status = StatusDown
+	} else if active && severity == SeverityDrain {
+		status = StatusDrain
+	}
+	return status, strings.Join(reasons, ",")
+}
+
+// Reads the profiles file, a JSON object of profile name to definition
+func LoadProfiles(path string, base CheckConfig, baseLevels map[string]CheckLevel, fallback CheckLevel) (profiles map[string]*ProfileState, err error) {
+	profiles = map[string]*ProfileState{}
+	if path == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("couldn't parse profiles %s: %v", path, err)
+	}
+
+	for name, message := range raw {
+		definition := ProfileDefinition{CheckConfig: base}
+		if err = json.Unmarshal(message, &definition); err != nil {
+			return nil, fmt.Errorf("couldn't parse profile %s: %v", name, err)
+		}
+
+		levels := map[string]CheckLevel{}
+		for k, v := range baseLevels {
+			levels[k] = v
+		}
+		if err = ParseCheckLevels(definition.Levels, levels); err != nil {
+			return nil, fmt.Errorf("invalid levels in profile %s: %v", name, err)
+		}
+
+		profiles[name] = NewProfileState(name, definition.CheckConfig, levels, fallback)
+	}
+	return
+}
@@ -0,0 +1,172 @@
+package simulation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+)
+
+type DampeningConfig struct {
+	Penalty, Suppress, Reuse          float64
+	HalfLife, MaxSuppress, FlapWindow time.Duration
+}
+
+// A check configuration of the agent, as used by scenarios and the what-if analyzer
+type Checks struct {
+	Config   solanahc.CheckConfig
+	Levels   map[string]solanahc.CheckLevel
+	Fallback solanahc.CheckLevel
+	// Number of load failures after which the node is stale
+	StaleAfter uint64
+	Dampening  *DampeningConfig
+}
+
+// The defaults of the agent's flags
+func DefaultChecks() Checks {
+	return Checks{
+		Config: solanahc.CheckConfig{
+			MaxSlotDiff:     200,
+			MaxBlockDiff:    300,
+			RetransmitCheck: true,
+			GenesisCheck:    true,
+		},
+		Levels:     solanahc.DefaultCheckLevels(2, 4),
+		Fallback:   solanahc.CheckLevel{Severity: solanahc.SeverityDown, Rise: 2, Fall: 4},
+		StaleAfter: 3,
+	}
+}
+
+// Returns a HealthState with these checks
+func (c Checks) NewHealthState(rpcUri string) *solanahc.HealthState {
+	levels := map[string]solanahc.CheckLevel{}
+	for name, level := range c.Levels {
+		levels[name] = level
+	}
+	health_state := solanahc.NewHealthState(rpcUri, c.Config, levels, c.Fallback)
+	health_state.StaleAfter = c.StaleAfter
+	if d := c.Dampening; d != nil {
+		health_state.Dampener = solanahc.NewDampener(d.Penalty, d.Suppress, d.Reuse, d.HalfLife, d.MaxSuppress, d.FlapWindow)
+	}
+	return health_state
+}
+
+// Splits key=value arguments
+func options(fields []string) (map[string]string, error) {
+	opts := map[string]string{}
+	for _, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected key=value, got %q", f)
+		}
+		opts[kv[0]] = kv[1]
+	}
+	return opts, nil
+}
+
+// Updates the checks from key=value options named like the agent's flags:
+// slot-diff, block-diff, up, down, ledger (minimum ledger size), blocks, retransmit,
+// genesis, health, fork, accounts (comma separated), stall and block-age (durations), processed-gap, stale and levels in the -check-levels format. The levels are reset to up and down.
+func (c *Checks) ParseOptions(fields []string) error {
+	opts, err := options(fields)
+	if err != nil {
+		return err
+	}
+
+	up, down := c.Fallback.Rise, c.Fallback.Fall
+	levels := ""
+	for key, value := range opts {
+		var n int
+		var b bool
+		switch key {
+		case "slot-diff", "block-diff", "up", "down", "ledger", "stale", "processed-gap":
+			n, err = strconv.Atoi(value)
+		case "blocks", "retransmit", "genesis", "health", "fork":
+			b, err = strconv.ParseBool(value)
+		case "stall", "block-age":
+			var d time.Duration
+			d, err = time.ParseDuration(value)
+			if key == "stall" {
+				c.Config.MaxStallSeconds = int(d.Seconds())
+			} else {
+				c.Config.MaxBlockAgeSeconds = int(d.Seconds())
+			}
+		case "accounts":
+			c.Config.Accounts = strings.Split(value, ",")
+		case "levels":
+			levels = value
+		default:
+			return fmt.Errorf("unknown check option %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+
+		switch key {
+		case "slot-diff":
+			c.Config.MaxSlotDiff = n
+		case "block-diff":
+			c.Config.MaxBlockDiff = n
+		case "up":
+			up = n
+		case "down":
+			down = n
+		case "ledger":
+			c.Config.MinimumLedgerSize = n
+		case "processed-gap":
+			c.Config.MaxProcessedGap = n
+		case "stale":
+			c.StaleAfter = uint64(n)
+		case "blocks":
+			c.Config.BlockCheck = b
+		case "retransmit":
+			c.Config.RetransmitCheck = b
+		case "genesis":
+			c.Config.GenesisCheck = b
+		case "health":
+			c.Config.HealthCheck = b
+		case "fork":
+			c.Config.ForkCheck = b
+		}
+	}
+
+	c.Levels = solanahc.DefaultCheckLevels(up, down)
+	c.Fallback = solanahc.CheckLevel{Severity: solanahc.SeverityDown, Rise: up, Fall: down}
+	return solanahc.ParseCheckLevels(levels, c.Levels)
+}
+
+// Enables flap dampening from key=value options: penalty, suppress, reuse, half-life,
+// max-suppress and flap-window, defaulting to the agent's flags
+func (c *Checks) ParseDampening(fields []string) error {
+	opts, err := options(fields)
+	if err != nil {
+		return err
+	}
+
+	d := &DampeningConfig{Penalty: 1000, Suppress: 2000, Reuse: 750, HalfLife: 15 * time.Minute, MaxSuppress: time.Hour, FlapWindow: 10 * time.Minute}
+	for key, value := range opts {
+		switch key {
+		case "penalty":
+			d.Penalty, err = strconv.ParseFloat(value, 64)
+		case "suppress":
+			d.Suppress, err = strconv.ParseFloat(value, 64)
+		case "reuse":
+			d.Reuse, err = strconv.ParseFloat(value, 64)
+		case "half-life":
+			d.HalfLife, err = time.ParseDuration(value)
+		case "max-suppress":
+			d.MaxSuppress, err = time.ParseDuration(value)
+		case "flap-window":
+			d.FlapWindow, err = time.ParseDuration(value)
+		default:
+			return fmt.Errorf("unknown dampening option %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	c.Dampening = d
+	return nil
+}
@@ -0,0 +1,55 @@
+package simulation
+
+import (
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	"github.com/linuskendall/solana-rpc-health-check/rpc/rpctest"
+)
+
+// A healthy target and one 1000 slots behind, checked against two references. For the tests
+// of the commands that publish the verdicts, every check goes down and up at once.
+type Cluster struct {
+	Healthy    *rpctest.Server
+	Behind     *rpctest.Server
+	References []*rpctest.Server
+	Config     solanahc.CheckConfig
+	Levels     map[string]solanahc.CheckLevel
+	Fallback   solanahc.CheckLevel
+}
+
+func NewCluster() *Cluster {
+	c := &Cluster{
+		Healthy:    rpctest.NewServer(),
+		Behind:     rpctest.NewServer(),
+		References: []*rpctest.Server{rpctest.NewServer(), rpctest.NewServer()},
+		Config:     solanahc.CheckConfig{MaxSlotDiff: 200, MaxBlockDiff: 300, GenesisCheck: true},
+		Levels:     solanahc.DefaultCheckLevels(1, 1),
+		Fallback:   solanahc.CheckLevel{Severity: solanahc.SeverityDown, Rise: 1, Fall: 1},
+	}
+	c.Behind.SetSlot(c.Behind.Slot() - 1000)
+	return c
+}
+
+func (c *Cluster) ReferenceURLs() (urls []string) {
+	for _, s := range c.References {
+		urls = append(urls, s.URL)
+	}
+	return
+}
+
+// Returns a health state for rpcUri with the checks of the cluster
+func (c *Cluster) HealthState(rpcUri string) *solanahc.HealthState {
+	return solanahc.NewHealthState(rpcUri, c.Config, c.Levels, c.Fallback)
+}
+
+// Returns a monitor of the targets against the references
+func (c *Cluster) Monitor(targets []*solanahc.HealthState) *solanahc.Monitor {
+	return solanahc.NewMonitor(targets, c.ReferenceURLs())
+}
+
+func (c *Cluster) Close() {
+	c.Healthy.Close()
+	c.Behind.Close()
+	for _, s := range c.References {
+		s.Close()
+	}
+}
@@ -0,0 +1,158 @@
+package simulation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linuskendall/solana-rpc-health-check/rpc"
+	"github.com/linuskendall/solana-rpc-health-check/rpc/rpctest"
+)
+
+// Reads a scenario, one statement per line and # starts a comment:
+//
+//	name <text>
+//	interval 10s
+//	duration 5m
+//	epoch <slots per epoch>
+//	check slot-diff=200 block-diff=300 up=2 down=4 ledger=0 blocks=false retransmit=true genesis=true health=false fork=false accounts=<a,b> stall=0s block-age=0s processed-gap=0 stale=3 levels=behind:drain
+//	dampening penalty=1000 suppress=2000 reuse=750 half-life=15m max-suppress=1h flap-window=10m
+//	node <name> [slot=10000000] [rate=2.5] [genesis=sim] [ledger=500000]
+//	at <time> <node|references> <action> [argument]
+//	expect <time> <answer>
+//
+// The first node is the target. The actions are behind <slots>, catchup, advance <slots>, stall,
+// resume, rate <slots per second>, down, up, error <method>, ok <method>, latency <duration>,
+// unhealthy [slots], healthy, fork [name], account <address> [data], genesis <hash>, ledger <slots> and holes <slots>.
+func ParseScenario(r io.Reader, name string) (sc *Scenario, err error) {
+	sc = NewScenario(name)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 && !strings.HasPrefix(strings.TrimSpace(text), "expect") {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if err = sc.parseStatement(fields); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+	}
+	return sc, scanner.Err()
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseScenario(file, filepath.Base(path))
+}
+
+// Parses a duration like 30s, a plain number is taken as seconds
+func parseTime(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (sc *Scenario) parseStatement(fields []string) (err error) {
+	switch fields[0] {
+	case "name":
+		sc.Name = strings.Join(fields[1:], " ")
+	case "interval", "duration":
+		if len(fields) != 2 {
+			return fmt.Errorf("%s needs a duration", fields[0])
+		}
+		d, err := parseTime(fields[1])
+		if err != nil {
+			return err
+		}
+		if fields[0] == "interval" {
+			sc.Interval = d
+		} else {
+			sc.Duration = d
+		}
+	case "epoch":
+		var slots uint64
+		if len(fields) != 2 {
+			return fmt.Errorf("epoch needs the slots per epoch")
+		}
+		if slots, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return err
+		}
+		sc.Schedule = rpc.NewEpochSchedule(slots, slots, false)
+	case "check":
+		return sc.Checks.ParseOptions(fields[1:])
+	case "dampening":
+		return sc.Checks.ParseDampening(fields[1:])
+	case "node":
+		return sc.parseNode(fields[1:])
+	case "at":
+		if len(fields) < 4 {
+			return fmt.Errorf("expected at <time> <node> <action> [argument]")
+		}
+		e := Event{Node: fields[2], Action: fields[3], Arg: strings.Join(fields[4:], " ")}
+		if e.At, err = parseTime(fields[1]); err != nil {
+			return err
+		}
+		sc.Events = append(sc.Events, e)
+	case "expect":
+		if len(fields) < 3 {
+			return fmt.Errorf("expected expect <time> <answer>")
+		}
+		e := Expect{Answer: strings.Join(fields[2:], " ")}
+		if e.At, err = parseTime(fields[1]); err != nil {
+			return err
+		}
+		sc.Expects = append(sc.Expects, e)
+	default:
+		return fmt.Errorf("unknown statement %q", fields[0])
+	}
+	return nil
+}
+
+func (sc *Scenario) parseNode(fields []string) error {
+	if len(fields) < 1 {
+		return fmt.Errorf("node needs a name")
+	}
+	if fields[0] == References {
+		return fmt.Errorf("%q can't be used as a node name", References)
+	}
+	opts, err := options(fields[1:])
+	if err != nil {
+		return err
+	}
+
+	n := Node{Name: fields[0], Slot: 10000000, Rate: rpctest.DefaultSlotRate, Genesis: "sim", Ledger: 500000}
+	for key, value := range opts {
+		switch key {
+		case "slot":
+			var slot uint64
+			slot, err = strconv.ParseUint(value, 10, 64)
+			n.Slot = rpc.Slot(slot)
+		case "rate":
+			n.Rate, err = strconv.ParseFloat(value, 64)
+		case "genesis":
+			n.Genesis = value
+		case "ledger":
+			n.Ledger, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return fmt.Errorf("unknown node option %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	sc.Nodes = append(sc.Nodes, n)
+	return nil
+}
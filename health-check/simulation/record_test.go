@@ -0,0 +1,142 @@
+package simulation
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+var update = flag.Bool("update", false, "Record testdata/agent.ndjson again")
+
+// The nodes in testdata/agent.ndjson, the recorded urls are replaced with these
+var (
+	fixtureNodes      = []string{"http://healthy:8899", "http://behind:8899"}
+	fixtureReferences = []string{"http://ref1:8899", "http://ref2:8899"}
+)
+
+// The answers for the nodes of the cluster in every round of the recording, the node
+// behind catches up in the third round
+var recordedAnswers = [][]string{
+	{"up", "down #behind"},
+	{"up", "down #behind"},
+	{"up", "up"},
+	{"up", "up"},
+}
+
+// Checks the nodes of the cluster, records the rpc traffic to path and returns the answers
+func record(t *testing.T, c *Cluster, path string) (answers [][]string) {
+	recorder, err := solanarpc.OpenRecorder(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	targets := []*solanahc.HealthState{c.HealthState(c.Healthy.URL), c.HealthState(c.Behind.URL)}
+	monitor := c.Monitor(targets)
+	monitor.Transport = recorder
+	for round := range recordedAnswers {
+		if round == 2 {
+			c.Behind.SetSlot(c.Healthy.Slot())
+		}
+		monitor.Check()
+		answers = append(answers, []string{targets[0].GetStatus(), targets[1].GetStatus()})
+	}
+	return
+}
+
+// Replays the recording at path through a monitor of the nodes and returns the answers
+func replay(t *testing.T, c *Cluster, path string, nodes []string, references []string) (answers [][]string) {
+	replayer, err := solanarpc.LoadReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := []*solanahc.HealthState{}
+	for _, node := range nodes {
+		target := c.HealthState(node)
+		target.Clock = replayer.Now
+		targets = append(targets, target)
+	}
+	monitor := solanahc.NewMonitor(targets, references)
+	monitor.Transport = replayer
+	// Stop once a check doesn't find any recorded responses
+	for replayer.Remaining() > 0 {
+		remaining := replayer.Remaining()
+		monitor.Check()
+		if replayer.Remaining() == remaining {
+			break
+		}
+		round := []string{}
+		for _, target := range targets {
+			round = append(round, target.GetStatus())
+		}
+		answers = append(answers, round)
+	}
+	return
+}
+
+// Replaying a recording gives the verdicts of the recorded checks
+func TestRecordReplay(t *testing.T) {
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	c := NewCluster()
+	defer c.Close()
+
+	path := filepath.Join(t.TempDir(), "agent.ndjson")
+	recorded := record(t, c, path)
+	if !reflect.DeepEqual(recorded, recordedAnswers) {
+		t.Fatalf("got answers %v while recording, want %v", recorded, recordedAnswers)
+	}
+
+	// The nodes are gone, every response comes from the recording
+	c.Close()
+	replayed := replay(t, c, path, []string{c.Healthy.URL, c.Behind.URL}, c.ReferenceURLs())
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("got answers %v while replaying, want the recorded %v", replayed, recorded)
+	}
+}
+
+// Replays the checked in recording, run with -update to record it again
+func TestReplayFixture(t *testing.T) {
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	c := NewCluster()
+	defer c.Close()
+
+	fixture := filepath.Join("testdata", "agent.ndjson")
+	if *update {
+		path := filepath.Join(t.TempDir(), "agent.ndjson")
+		record(t, c, path)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls := append([]string{c.Healthy.URL, c.Behind.URL}, c.ReferenceURLs()...)
+		names := append(append([]string{}, fixtureNodes...), fixtureReferences...)
+		for i := range urls {
+			data = bytes.ReplaceAll(data, []byte(urls[i]), []byte(names[i]))
+		}
+		if err := ioutil.WriteFile(fixture, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replayed := replay(t, c, fixture, fixtureNodes, fixtureReferences)
+	if !reflect.DeepEqual(replayed, recordedAnswers) {
+		t.Errorf("got answers %v from %s, want %v", replayed, fixture, recordedAnswers)
+	}
+}
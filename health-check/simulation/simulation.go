@@ -0,0 +1,289 @@
+// Package simulation runs scripted timelines against a HealthState and records the
+// answers of the agent. The nodes are rpctest servers, so the states are loaded the
+// same way as in the agent, but time only advances from check to check.
+package simulation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	solanahc "github.com/linuskendall/solana-rpc-health-check/health-check"
+	"github.com/linuskendall/solana-rpc-health-check/rpc"
+	"github.com/linuskendall/solana-rpc-health-check/rpc/rpctest"
+)
+
+// All simulations start at this time
+var Start = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// A node at the start of the simulation, the first node of a scenario is the target
+type Node struct {
+	Name    string
+	Slot    rpc.Slot
+	Rate    float64
+	Genesis string
+	Ledger  uint64
+}
+
+// Something that happens to a node, or to all references if Node is References
+type Event struct {
+	At     time.Duration
+	Node   string
+	Action string
+	Arg    string
+}
+
+const References = "references"
+
+// The answer expected at a time, the last answer given up to then
+type Expect struct {
+	At     time.Duration
+	Answer string
+}
+
+type Scenario struct {
+	Name     string
+	Interval time.Duration
+	Duration time.Duration
+	Schedule rpc.EpochSchedule
+	Nodes    []Node
+	Checks   Checks
+	Events   []Event
+	Expects  []Expect
+}
+
+// Returns a scenario with the defaults of the agent, checking every 10s for 5 minutes
+func NewScenario(name string) *Scenario {
+	return &Scenario{
+		Name:     name,
+		Interval: 10 * time.Second,
+		Duration: 5 * time.Minute,
+		// Short epochs keep the block lists small
+		Schedule: rpc.NewEpochSchedule(4320, 4320, false),
+		Checks:   DefaultChecks(),
+	}
+}
+
+// The answer of the agent after a check
+type Step struct {
+	At     time.Duration
+	Answer string
+}
+
+type Result struct {
+	Steps    []Step
+	Failures []string
+}
+
+// Returns the steps at which the answer changed, including the first one
+func (r Result) Changes() (changes []Step) {
+	for i, step := range r.Steps {
+		if i == 0 || step.Answer != r.Steps[i-1].Answer {
+			changes = append(changes, step)
+		}
+	}
+	return
+}
+
+// Returns the answer given at a time, the one of the last check up to then
+func (r Result) AnswerAt(at time.Duration) (answer string, ok bool) {
+	for _, step := range r.Steps {
+		if step.At > at {
+			break
+		}
+		answer, ok = step.Answer, true
+	}
+	return
+}
+
+type world struct {
+	now     time.Time
+	nodes   map[string]*rpctest.Server
+	names   []string
+	servers []*rpctest.Server
+}
+
+func (w *world) clock() time.Time {
+	return w.now
+}
+
+// The highest slot of all nodes but one
+func (w *world) maxSlotExcept(name string) (slot rpc.Slot) {
+	for n, s := range w.nodes {
+		if n != name && s.Slot() > slot {
+			slot = s.Slot()
+		}
+	}
+	return
+}
+
+func (w *world) apply(e Event) error {
+	names := []string{e.Node}
+	if e.Node == References {
+		names = w.names[1:]
+	}
+	for _, name := range names {
+		node, ok := w.nodes[name]
+		if !ok {
+			return fmt.Errorf("unknown node %q", name)
+		}
+		if err := applyAction(w, name, node, e.Action, e.Arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyAction(w *world, name string, node *rpctest.Server, action string, arg string) (err error) {
+	var n uint64
+	var d time.Duration
+	var f float64
+	switch action {
+	case "behind":
+		if _, err = fmt.Sscan(arg, &n); err == nil {
+			max := w.maxSlotExcept(name)
+			if rpc.Slot(n) > max {
+				n = uint64(max)
+			}
+			node.SetSlot(max - rpc.Slot(n))
+		}
+	case "catchup":
+		node.SetSlot(w.maxSlotExcept(name))
+	case "advance":
+		if _, err = fmt.Sscan(arg, &n); err == nil {
+			node.Advance(n)
+		}
+	case "stall":
+		node.Stall()
+	case "resume":
+		node.Resume()
+	case "rate":
+		if _, err = fmt.Sscan(arg, &f); err == nil {
+			node.SetSlotRate(f)
+		}
+	case "down":
+		node.SetHTTPStatus(503)
+	case "up":
+		node.SetHTTPStatus(0)
+	case "error":
+		node.SetError(arg, &rpctest.Error{Code: rpctest.CodeInternalError, Message: "simulated error"})
+	case "ok":
+		node.SetError(arg, nil)
+	case "latency":
+		if d, err = time.ParseDuration(arg); err == nil {
+			node.SetLatency("*", d)
+		}
+	case "unhealthy":
+		// getHealth reports the node as behind by n slots, or without a number
+		if arg == "" {
+			node.SetUnhealthy(nil)
+		} else if _, err = fmt.Sscan(arg, &n); err == nil {
+			node.SetUnhealthy(&n)
+		}
+	case "healthy":
+		node.SetHealthy()
+	case "fork":
+		// The blocks from the next slot on are on the named fork, without a name on the main chain
+		node.SetFork(arg)
+	case "account":
+		// account <address> [data], without data the account is removed
+		fields := strings.SplitN(arg, " ", 2)
+		if len(fields) == 2 {
+			node.SetAccountData(fields[0], []byte(fields[1]))
+		} else {
+			node.SetAccountData(fields[0], nil)
+		}
+	case "genesis":
+		node.SetGenesisHash(arg)
+	case "ledger":
+		if _, err = fmt.Sscan(arg, &n); err == nil {
+			node.SetLedgerSize(n)
+		}
+	case "holes":
+		// Skips n slots before the current slot
+		if _, err = fmt.Sscan(arg, &n); err == nil {
+			slot := node.Slot()
+			if rpc.Slot(n) > slot {
+				n = uint64(slot)
+			}
+			node.SkipRange(slot-rpc.Slot(n), slot)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid argument %q for %s: %v", arg, action, err)
+	}
+	return nil
+}
+
+// Runs the scenario from a fresh HealthState and checks the expected answers
+func (sc *Scenario) Run() (result Result, err error) {
+	if len(sc.Nodes) == 0 {
+		return result, fmt.Errorf("no nodes")
+	}
+	if sc.Interval <= 0 {
+		return result, fmt.Errorf("interval has to be positive")
+	}
+
+	// The servers of earlier runs may have had the same urls
+	rpc.EpochSchedules = rpc.NewEpochScheduleCache()
+	// The nodes only advance with the simulated time, waiting for one to reach a slot is of no use
+	solanahc.AccountRetryDelay = 0
+
+	events := append([]Event{}, sc.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+
+	w := &world{now: Start, nodes: map[string]*rpctest.Server{}}
+	defer func() {
+		for _, s := range w.servers {
+			s.Close()
+		}
+	}()
+	for _, n := range sc.Nodes {
+		s := rpctest.NewServer()
+		// The block times are anchored at the slot when the clock is set
+		s.SetSlot(n.Slot)
+		s.SetClock(w.clock)
+		s.SetEpochSchedule(sc.Schedule)
+		s.SetSlotRate(n.Rate)
+		s.SetGenesisHash(n.Genesis)
+		s.SetLedgerSize(n.Ledger)
+		w.nodes[n.Name] = s
+		w.names = append(w.names, n.Name)
+		w.servers = append(w.servers, s)
+	}
+
+	// The rpc uris are only known now, so the target is the first node's server
+	health_state := sc.Checks.NewHealthState(w.servers[0].URL)
+	health_state.Clock = w.clock
+	references := []string{}
+	for _, s := range w.servers[1:] {
+		references = append(references, s.URL)
+	}
+	monitor := solanahc.NewMonitor([]*solanahc.HealthState{health_state}, references)
+
+	applied := 0
+	for at := time.Duration(0); at <= sc.Duration; at += sc.Interval {
+		w.now = Start.Add(at)
+		for applied < len(events) && events[applied].At <= at {
+			if err = w.apply(events[applied]); err != nil {
+				return result, fmt.Errorf("event at %s: %v", events[applied].At, err)
+			}
+			applied++
+		}
+		monitor.Check()
+		result.Steps = append(result.Steps, Step{At: at, Answer: health_state.GetStatus()})
+	}
+
+	for _, e := range sc.Expects {
+		answer, ok := result.AnswerAt(e.At)
+		if !ok {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: expected %q, but there was no check yet", e.At, e.Answer))
+		} else if answer != e.Answer {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: expected %q, got %q", e.At, e.Answer, answer))
+		}
+	}
+	return
+}
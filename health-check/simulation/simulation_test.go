@@ -0,0 +1,47 @@
+package simulation
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Runs every scenario in scenarios/, which all have to meet their expectations
+func TestScenarios(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("scenarios", "*.sim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no scenarios found")
+	}
+
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			sc, err := LoadScenario(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sc.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range result.Failures {
+				t.Error("expectation failed: ", f)
+			}
+			if t.Failed() {
+				for _, step := range result.Changes() {
+					t.Logf("%8s  %s", step.At, step.Answer)
+				}
+			}
+		})
+	}
+}
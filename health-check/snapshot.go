@@ -0,0 +1,62 @@
+package solanahc
+
+import (
+	"time"
+
+	solanarpc "github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+// A serialisable copy of a NodeState, block lists are reduced to their length
+type NodeSnapshot struct {
+	RpcNode           string                 `json:"rpcNode"`
+	HasErrors         bool                   `json:"hasErrors"`
+	Errors            []string               `json:"errors,omitempty"`
+	MinimumSlot       solanarpc.Slot         `json:"minimumSlot"`
+	CurrentSlot       solanarpc.Slot         `json:"currentSlot"`
+	FinalizedSlot     solanarpc.Slot         `json:"finalizedSlot,omitempty"`
+	ProcessedSlot     solanarpc.Slot         `json:"processedSlot"`
+	MaxRetransmitSlot solanarpc.Slot         `json:"maxRetransmitSlot"`
+	Version           solanarpc.Version      `json:"version"`
+	Identity          string                 `json:"identity"`
+	GenesisHash       string                 `json:"genesisHash"`
+	Epoch             solanarpc.EpochInfo    `json:"epoch"`
+	PrevEpochBlocks   int                    `json:"prevEpochBlocks"`
+	CurEpochBlocks    int                    `json:"curEpochBlocks"`
+	Health            *solanarpc.Health      `json:"health,omitempty"`
+	BlockhashSlot     solanarpc.Slot         `json:"blockhashSlot,omitempty"`
+	Blockhash         string                 `json:"blockhash,omitempty"`
+	Accounts          map[string]AccountHash `json:"accounts,omitempty"`
+	BlockTime         int64                  `json:"blockTime,omitempty"`
+	Latency           time.Duration          `json:"latency"`
+}
+
+func (state *NodeState) Snapshot() (snapshot NodeSnapshot) {
+	snapshot = NodeSnapshot{
+		RpcNode:           state.RpcNode,
+		HasErrors:         state.HasErrors,
+		MinimumSlot:       state.MinimumSlot,
+		CurrentSlot:       state.CurrentSlot,
+		FinalizedSlot:     state.FinalizedSlot,
+		ProcessedSlot:     state.ProcessedSlot,
+		MaxRetransmitSlot: state.MaxRetransmitSlot,
+		Version:           state.Version,
+		Identity:          state.Identity.Identity,
+		GenesisHash:       state.GenesisHash,
+		Epoch:             state.Epoch,
+		PrevEpochBlocks:   len(state.PrevEpochBlocks),
+		CurEpochBlocks:    len(state.CurEpochBlocks),
+		Health:            state.Health,
+		BlockhashSlot:     state.BlockhashSlot,
+		Blockhash:         state.Blockhash,
+		Accounts:          state.Accounts,
+		BlockTime:         state.BlockTime,
+		Latency:           state.Latency,
+	}
+
+	for _, err := range state.Errors {
+		if err != nil {
+			snapshot.Errors = append(snapshot.Errors, err.Error())
+		}
+	}
+	return
+}
@@ -0,0 +1,118 @@
+package solanahc
+
+import (
+	"sort"
+)
+
+// The state of a single check across evaluations
+type CheckState struct {
+	Name     string   `json:"name"`
+	Severity Severity `json:"severity"`
+	// Active checks count towards the verdict, a check becomes active after Fall
+	// consecutive failures and inactive again after Rise consecutive passes
+	Active   bool   `json:"active"`
+	Failing  bool   `json:"failing"`
+	Reason   string `json:"reason,omitempty"`
+	Passes   int    `json:"passes"`
+	Failures int    `json:"failures"`
+	// Number of rounds in which the check couldn't be evaluated
+	Skipped int `json:"skipped"`
+}
+
+// Tracks the results of every check and combines them into a single verdict
+type CheckTracker struct {
+	levels   map[string]CheckLevel
+	fallback CheckLevel
+	states   map[string]*CheckState
+	order    []string
+	// Set once no check was active after a round, the node has started up
+	started bool
+}
+
+func NewCheckTracker(levels map[string]CheckLevel, fallback CheckLevel) *CheckTracker {
+	return &CheckTracker{
+		levels:   levels,
+		fallback: fallback,
+		states:   map[string]*CheckState{},
+	}
+}
+
+func (t *CheckTracker) level(name string) CheckLevel {
+	if level, ok := t.levels[name]; ok {
+		return level
+	}
+	return t.fallback
+}
+
+func (t *CheckTracker) Register(results []CheckResult) {
+	for _, result := range results {
+		level := t.level(result.Name)
+
+		cs, ok := t.states[result.Name]
+		if !ok {
+			// A check starts out active, so a node has to pass it rise times before it's healthy.
+			// A check first reported once the node is up, e.g. one that couldn't be evaluated
+			// before, starts inactive and has to fail fall times like any other.
+			cs = &CheckState{Name: result.Name, Severity: level.Severity, Active: !t.started && !result.Skipped}
+			t.states[result.Name] = cs
+			t.order = append(t.order, result.Name)
+		}
+
+		if result.Skipped {
+			cs.Skipped++
+			continue
+		}
+
+		cs.Failing = result.Failed
+		if result.Failed {
+			cs.Reason = result.Reason
+			cs.Passes = 0
+			cs.Failures++
+			if !cs.Active && cs.Failures >= level.Fall {
+				cs.Active = true
+			}
+		} else {
+			cs.Reason = ""
+			cs.Failures = 0
+			cs.Passes++
+			if cs.Active && cs.Passes >= level.Rise {
+				cs.Active = false
+			}
+		}
+	}
+
+	if _, active, _ := t.Verdict(); !active {
+		t.started = true
+	}
+}
+
+// Returns the most severe active check (ok is false if none is active) and the
+// reasons of all failing checks, most severe first
+func (t *CheckTracker) Verdict() (severity Severity, ok bool, reasons []string) {
+	failing := []*CheckState{}
+	for _, name := range t.order {
+		cs := t.states[name]
+		if cs.Active && (!ok || cs.Severity > severity) {
+			severity = cs.Severity
+			ok = true
+		}
+		if cs.Failing {
+			failing = append(failing, cs)
+		}
+	}
+
+	sort.SliceStable(failing, func(i, j int) bool {
+		return failing[i].Severity > failing[j].Severity
+	})
+	for _, cs := range failing {
+		reasons = append(reasons, cs.Reason)
+	}
+	return
+}
+
+func (t *CheckTracker) States() (states []CheckState) {
+	for _, name := range t.order {
+		states = append(states, *t.states[name])
+	}
+	return
+}
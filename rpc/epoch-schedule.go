@@ -1,8 +1,9 @@
 package rpc
 
 import (
-	"math"
+	"context"
 	"math/bits"
+	"sync"
 )
 
 type EpochSchedule struct {
@@ -10,13 +11,38 @@ type EpochSchedule struct {
 	FirstNormalSlot          Slot   `json:"firstNormalSlot"`
 	LeaderScheduleSlotOffset uint64 `json:"leaderScheduleSlotOffset"`
 	SlotsPerEpoch            uint64 `json:"slotsPerEpoch"`
-	warmup                   bool   `json:"warmup"`
+	Warmup                   bool   `json:"warmup"`
+}
+
+var minimumSlotsPerEpochLog2 = bits.TrailingZeros64(MINIMUM_SLOTS_PER_EPOCH)
+
+// Same as EpochSchedule::custom in the Solana source. With warmup the epochs start at
+// MINIMUM_SLOTS_PER_EPOCH slots and double until they reach slotsPerEpoch.
+func NewEpochSchedule(slotsPerEpoch uint64, leaderScheduleSlotOffset uint64, warmup bool) EpochSchedule {
+	e := EpochSchedule{
+		LeaderScheduleSlotOffset: leaderScheduleSlotOffset,
+		SlotsPerEpoch:            slotsPerEpoch,
+		Warmup:                   warmup,
+	}
+	if warmup {
+		nextPowerOfTwo := nextPowerOfTwo(slotsPerEpoch)
+		e.FirstNormalEpoch = Epoch(bits.TrailingZeros64(nextPowerOfTwo) - minimumSlotsPerEpochLog2)
+		e.FirstNormalSlot = Slot(nextPowerOfTwo - MINIMUM_SLOTS_PER_EPOCH)
+	}
+	return e
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << (64 - bits.LeadingZeros64(n-1))
 }
 
 // From Solana source logic
 func (e *EpochSchedule) GetSlotsInEpoch(epoch Epoch) (slots uint64) {
 	if epoch < e.FirstNormalEpoch {
-		return uint64(math.Pow(2, float64(int(epoch)+bits.TrailingZeros(uint(MINIMUM_SLOTS_PER_EPOCH)))))
+		return 1 << (uint64(epoch) + uint64(minimumSlotsPerEpochLog2))
 	} else {
 		return e.SlotsPerEpoch
 	}
@@ -24,7 +50,7 @@ func (e *EpochSchedule) GetSlotsInEpoch(epoch Epoch) (slots uint64) {
 
 func (e *EpochSchedule) GetFirstSlotInEpoch(epoch Epoch) (slot Slot) {
 	if epoch <= e.FirstNormalEpoch {
-		return Slot(uint64(math.Pow(2, float64(epoch))-1) * MINIMUM_SLOTS_PER_EPOCH)
+		return Slot(((1 << uint64(epoch)) - 1) * MINIMUM_SLOTS_PER_EPOCH)
 	} else {
 		return Slot(uint64(epoch-e.FirstNormalEpoch)*e.SlotsPerEpoch) + e.FirstNormalSlot
 	}
@@ -36,22 +62,66 @@ func (e *EpochSchedule) GetLastSlotInEpoch(epoch Epoch) (slot Slot) {
 
 func (e *EpochSchedule) GetEpochAndSlotIndex(slot Slot) (epoch Epoch, slotIndex uint64) {
 	if slot < e.FirstNormalSlot {
-		/*
-		   let epoch = (slot + MINIMUM_SLOTS_PER_EPOCH + 1)
-		       .next_power_of_two()
-		       .trailing_zeros()
-		       - MINIMUM_SLOTS_PER_EPOCH.trailing_zeros()
-		       - 1;
-
-		   let epoch_len = 2u64.pow(epoch + MINIMUM_SLOTS_PER_EPOCH.trailing_zeros());
-
-		   (
-		       u64::from(epoch),
-		       slot - (epoch_len - MINIMUM_SLOTS_PER_EPOCH),
-		   )
-		*/
-		return 0, 0
+		// The warmup epoch n starts at (2^n - 1) * MINIMUM_SLOTS_PER_EPOCH
+		epoch = Epoch(bits.TrailingZeros64(nextPowerOfTwo(uint64(slot)+MINIMUM_SLOTS_PER_EPOCH+1)) - minimumSlotsPerEpochLog2 - 1)
+		epochLen := uint64(1) << (uint64(epoch) + uint64(minimumSlotsPerEpochLog2))
+		return epoch, uint64(slot) - (epochLen - MINIMUM_SLOTS_PER_EPOCH)
+	} else if e.SlotsPerEpoch == 0 {
+		return e.FirstNormalEpoch, 0
 	} else {
 		return e.FirstNormalEpoch + Epoch(uint64(slot-e.FirstNormalSlot)/e.SlotsPerEpoch), uint64(slot-e.FirstNormalSlot) % e.SlotsPerEpoch
 	}
 }
+
+// The epoch schedule never changes for a cluster, so it's fetched once per genesis hash.
+// The genesis hash is remembered per rpc url.
+type EpochScheduleCache struct {
+	mu        sync.Mutex
+	schedules map[string]EpochSchedule
+	genesis   map[string]string
+}
+
+var EpochSchedules = NewEpochScheduleCache()
+
+func NewEpochScheduleCache() *EpochScheduleCache {
+	return &EpochScheduleCache{
+		schedules: map[string]EpochSchedule{},
+		genesis:   map[string]string{},
+	}
+}
+
+// Returns the cached schedule of the client's cluster, fetching the genesis hash and schedule when unknown
+func (c *EpochScheduleCache) Get(ctx context.Context, client *Client) (schedule EpochSchedule, err error) {
+	c.mu.Lock()
+	hash, ok := c.genesis[client.url]
+	c.mu.Unlock()
+
+	if !ok {
+		if hash, err = client.GetGenesisHash(ctx); err != nil {
+			return
+		}
+		c.SetGenesisHash(client.url, hash)
+	}
+
+	c.mu.Lock()
+	schedule, ok = c.schedules[hash]
+	c.mu.Unlock()
+	if ok {
+		return
+	}
+
+	if schedule, err = client.GetEpochSchedule(ctx); err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.schedules[hash] = schedule
+	c.mu.Unlock()
+	return
+}
+
+// Records the genesis hash of an rpc url, e.g. after it was loaded anyway, so a node moved to another cluster gets its schedule
+func (c *EpochScheduleCache) SetGenesisHash(url string, hash string) {
+	c.mu.Lock()
+	c.genesis[url] = hash
+	c.mu.Unlock()
+}
@@ -0,0 +1,131 @@
+package rpc
+
+import "testing"
+
+// Schedules as returned by getEpochSchedule
+var (
+	// devnet and testnet
+	warmupSchedule = EpochSchedule{FirstNormalEpoch: 14, FirstNormalSlot: 524256, LeaderScheduleSlotOffset: 432000, SlotsPerEpoch: 432000, Warmup: true}
+	// solana-test-validator
+	localnetSchedule = EpochSchedule{FirstNormalEpoch: 0, FirstNormalSlot: 0, LeaderScheduleSlotOffset: 432000, SlotsPerEpoch: 432000, Warmup: false}
+	// A local cluster from solana-genesis with the development slots per epoch
+	developmentSchedule = EpochSchedule{FirstNormalEpoch: 8, FirstNormalSlot: 8160, LeaderScheduleSlotOffset: 8192, SlotsPerEpoch: 8192, Warmup: true}
+)
+
+func TestNewEpochSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule EpochSchedule
+		want     EpochSchedule
+	}{
+		{name: "devnet", schedule: NewEpochSchedule(432000, 432000, true), want: warmupSchedule},
+		{name: "localnet", schedule: NewEpochSchedule(432000, 432000, false), want: localnetSchedule},
+		{name: "development", schedule: NewEpochSchedule(8192, 8192, true), want: developmentSchedule},
+		{name: "minimum", schedule: NewEpochSchedule(MINIMUM_SLOTS_PER_EPOCH, MINIMUM_SLOTS_PER_EPOCH, true), want: EpochSchedule{
+			LeaderScheduleSlotOffset: MINIMUM_SLOTS_PER_EPOCH, SlotsPerEpoch: MINIMUM_SLOTS_PER_EPOCH, Warmup: true,
+		}},
+	}
+
+	for _, test := range tests {
+		if test.schedule != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, test.schedule, test.want)
+		}
+	}
+}
+
+func TestGetEpochAndSlotIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedule  EpochSchedule
+		slot      Slot
+		epoch     Epoch
+		slotIndex uint64
+	}{
+		{name: "devnet", schedule: warmupSchedule, slot: 0, epoch: 0, slotIndex: 0},
+		{name: "devnet", schedule: warmupSchedule, slot: 31, epoch: 0, slotIndex: 31},
+		{name: "devnet", schedule: warmupSchedule, slot: 32, epoch: 1, slotIndex: 0},
+		{name: "devnet", schedule: warmupSchedule, slot: 95, epoch: 1, slotIndex: 63},
+		{name: "devnet", schedule: warmupSchedule, slot: 96, epoch: 2, slotIndex: 0},
+		{name: "devnet", schedule: warmupSchedule, slot: 262111, epoch: 12, slotIndex: 131071},
+		{name: "devnet", schedule: warmupSchedule, slot: 262112, epoch: 13, slotIndex: 0},
+		{name: "devnet", schedule: warmupSchedule, slot: 524255, epoch: 13, slotIndex: 262143},
+		{name: "devnet", schedule: warmupSchedule, slot: 524256, epoch: 14, slotIndex: 0},
+		{name: "devnet", schedule: warmupSchedule, slot: 956255, epoch: 14, slotIndex: 431999},
+		{name: "devnet", schedule: warmupSchedule, slot: 956256, epoch: 15, slotIndex: 0},
+		{name: "testnet", schedule: warmupSchedule, slot: 100000000, epoch: 244, slotIndex: 115744},
+		{name: "localnet", schedule: localnetSchedule, slot: 0, epoch: 0, slotIndex: 0},
+		{name: "localnet", schedule: localnetSchedule, slot: 431999, epoch: 0, slotIndex: 431999},
+		{name: "localnet", schedule: localnetSchedule, slot: 432000, epoch: 1, slotIndex: 0},
+		{name: "localnet", schedule: localnetSchedule, slot: 1000000, epoch: 2, slotIndex: 136000},
+		{name: "development", schedule: developmentSchedule, slot: 4063, epoch: 6, slotIndex: 2047},
+		{name: "development", schedule: developmentSchedule, slot: 4064, epoch: 7, slotIndex: 0},
+		{name: "development", schedule: developmentSchedule, slot: 8159, epoch: 7, slotIndex: 4095},
+		{name: "development", schedule: developmentSchedule, slot: 8160, epoch: 8, slotIndex: 0},
+		{name: "development", schedule: developmentSchedule, slot: 16352, epoch: 9, slotIndex: 0},
+	}
+
+	for _, test := range tests {
+		epoch, slotIndex := test.schedule.GetEpochAndSlotIndex(test.slot)
+		if epoch != test.epoch || slotIndex != test.slotIndex {
+			t.Errorf("%s slot %d: got epoch %d index %d, want epoch %d index %d", test.name, test.slot, epoch, slotIndex, test.epoch, test.slotIndex)
+		}
+	}
+}
+
+func TestEpochBoundaries(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedule  EpochSchedule
+		epoch     Epoch
+		firstSlot Slot
+		slots     uint64
+	}{
+		{name: "devnet", schedule: warmupSchedule, epoch: 0, firstSlot: 0, slots: 32},
+		{name: "devnet", schedule: warmupSchedule, epoch: 1, firstSlot: 32, slots: 64},
+		{name: "devnet", schedule: warmupSchedule, epoch: 13, firstSlot: 262112, slots: 262144},
+		{name: "devnet", schedule: warmupSchedule, epoch: 14, firstSlot: 524256, slots: 432000},
+		{name: "devnet", schedule: warmupSchedule, epoch: 15, firstSlot: 956256, slots: 432000},
+		{name: "localnet", schedule: localnetSchedule, epoch: 0, firstSlot: 0, slots: 432000},
+		{name: "localnet", schedule: localnetSchedule, epoch: 3, firstSlot: 1296000, slots: 432000},
+		{name: "development", schedule: developmentSchedule, epoch: 7, firstSlot: 4064, slots: 4096},
+		{name: "development", schedule: developmentSchedule, epoch: 8, firstSlot: 8160, slots: 8192},
+	}
+
+	for _, test := range tests {
+		if slot := test.schedule.GetFirstSlotInEpoch(test.epoch); slot != test.firstSlot {
+			t.Errorf("%s epoch %d: first slot is %d, want %d", test.name, test.epoch, slot, test.firstSlot)
+		}
+		if slots := test.schedule.GetSlotsInEpoch(test.epoch); slots != test.slots {
+			t.Errorf("%s epoch %d: has %d slots, want %d", test.name, test.epoch, slots, test.slots)
+		}
+		if slot := test.schedule.GetLastSlotInEpoch(test.epoch); slot != test.firstSlot+Slot(test.slots-1) {
+			t.Errorf("%s epoch %d: last slot is %d, want %d", test.name, test.epoch, slot, test.firstSlot+Slot(test.slots-1))
+		}
+	}
+}
+
+// Every epoch starts right after the previous one and maps back to itself
+func TestEpochRoundTrip(t *testing.T) {
+	schedules := map[string]EpochSchedule{
+		"devnet":      warmupSchedule,
+		"localnet":    localnetSchedule,
+		"development": developmentSchedule,
+	}
+
+	for name, schedule := range schedules {
+		for epoch := Epoch(0); epoch < 30; epoch++ {
+			first := schedule.GetFirstSlotInEpoch(epoch)
+			last := schedule.GetLastSlotInEpoch(epoch)
+			if epoch > 0 && first != schedule.GetLastSlotInEpoch(epoch-1)+1 {
+				t.Errorf("%s epoch %d: first slot %d doesn't follow the previous epoch", name, epoch, first)
+			}
+
+			for _, slot := range []Slot{first, first + (last-first)/2, last} {
+				got, slotIndex := schedule.GetEpochAndSlotIndex(slot)
+				if got != epoch || first+Slot(slotIndex) != slot {
+					t.Errorf("%s slot %d: got epoch %d index %d, want epoch %d index %d", name, slot, got, slotIndex, epoch, slot-first)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// A request and its response, one per line in a recording
+type Record struct {
+	Time    time.Time       `json:"t"`
+	Url     string          `json:"url"`
+	Request json.RawMessage `json:"req"`
+	// Set unless the request failed without a response
+	Status   int             `json:"status,omitempty"`
+	Response json.RawMessage `json:"resp,omitempty"`
+	Error    string          `json:"err,omitempty"`
+	Duration time.Duration   `json:"d"`
+}
+
+// Strips the id of a JSON-RPC request, so recorded requests match the replayed ones
+func requestKey(url string, body []byte) string {
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	json.Unmarshal(body, &req)
+	params := bytes.Buffer{}
+	json.Compact(&params, req.Params)
+	return url + " " + req.Method + " " + params.String()
+}
+
+// A body that's not JSON, e.g. an http error, is kept as a JSON string
+func rawBody(body []byte) json.RawMessage {
+	compact := bytes.Buffer{}
+	if json.Compact(&compact, body) == nil {
+		return compact.Bytes()
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// Writes every request and response passing through it to a file
+type Recorder struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Appends to the recording at path, next defaults to http.DefaultTransport
+func OpenRecorder(path string, next http.RoundTripper) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{next: next, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	record := Record{Time: time.Now(), Url: req.URL.String(), Request: rawBody(body)}
+	resp, err := r.next.RoundTrip(req)
+	if err == nil {
+		var respBody []byte
+		respBody, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+		record.Status = resp.StatusCode
+		record.Response = rawBody(respBody)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	record.Duration = time.Since(record.Time)
+
+	r.mu.Lock()
+	if e := r.enc.Encode(record); e != nil {
+		log.Println("couldn't write recording ", e)
+	}
+	r.mu.Unlock()
+	return resp, err
+}
+
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// Reads all records of a recording
+func ReadRecords(reader io.Reader) (records []Record, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record Record
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	err = scanner.Err()
+	return
+}
+
+var ErrNotRecorded = errors.New("no recorded response left for request")
+
+// Answers requests with the recorded responses. Every record is used once, in the
+// order they were recorded for the same url, method and params.
+type Replayer struct {
+	mu        sync.Mutex
+	queues    map[string][]Record
+	remaining int
+	now       time.Time
+}
+
+func NewReplayer(records []Record) *Replayer {
+	r := &Replayer{queues: map[string][]Record{}, remaining: len(records)}
+	for _, record := range records {
+		key := requestKey(record.Url, record.Request)
+		r.queues[key] = append(r.queues[key], record)
+	}
+	return r
+}
+
+func LoadReplayer(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, err := ReadRecords(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(records), nil
+}
+
+// Number of records not replayed yet
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining
+}
+
+// The time the last replayed response was recorded at
+func (r *Replayer) Now() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.now
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	key := requestKey(req.URL.String(), body)
+	r.mu.Lock()
+	queue := r.queues[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, ErrNotRecorded
+	}
+	record := queue[0]
+	r.queues[key] = queue[1:]
+	r.remaining--
+	if record.Time.After(r.now) {
+		r.now = record.Time
+	}
+	r.mu.Unlock()
+
+	if record.Status == 0 {
+		return nil, errors.New(record.Error)
+	}
+
+	respBody := []byte(record.Response)
+	var text string
+	if json.Unmarshal(record.Response, &text) == nil {
+		respBody = []byte(text)
+	} else {
+		respBody = replaceId(respBody, body)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", record.Status, http.StatusText(record.Status)),
+		StatusCode:    record.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// Sets the id of a recorded response to the one of the replayed request
+func replaceId(response []byte, request []byte) []byte {
+	var req struct {
+		Id json.RawMessage `json:"id"`
+	}
+	var resp map[string]json.RawMessage
+	if json.Unmarshal(request, &req) != nil || req.Id == nil || json.Unmarshal(response, &resp) != nil {
+		return response
+	}
+	resp["id"] = req.Id
+	replaced, err := json.Marshal(resp)
+	if err != nil {
+		return response
+	}
+	return replaced
+}
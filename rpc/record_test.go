@@ -0,0 +1,178 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequestKey(t *testing.T) {
+	key := requestKey("http://node:8899", []byte(`{"jsonrpc":"2.0","id":1,"method":"getSlot","params":[{"commitment":"confirmed"}]}`))
+	tests := []struct {
+		url   string
+		body  string
+		match bool
+	}{
+		{url: "http://node:8899", body: `{"jsonrpc":"2.0","id":7,"method":"getSlot","params":[{"commitment":"confirmed"}]}`, match: true},
+		{url: "http://node:8899", body: `{"method":"getSlot", "id":"a", "params":[ {"commitment": "confirmed"} ]}`, match: true},
+		{url: "http://node:8899", body: `{"id":1,"method":"getSlot","params":[{"commitment":"processed"}]}`, match: false},
+		{url: "http://node:8899", body: `{"id":1,"method":"getSlot"}`, match: false},
+		{url: "http://node:8899", body: `{"id":1,"method":"getEpochInfo","params":[{"commitment":"confirmed"}]}`, match: false},
+		{url: "http://other:8899", body: `{"id":1,"method":"getSlot","params":[{"commitment":"confirmed"}]}`, match: false},
+	}
+	for _, test := range tests {
+		if match := requestKey(test.url, []byte(test.body)) == key; match != test.match {
+			t.Errorf("%s %s: got match %v, want %v", test.url, test.body, match, test.match)
+		}
+	}
+}
+
+func TestReplaceId(t *testing.T) {
+	tests := []struct {
+		response string
+		request  string
+		replaced string
+	}{
+		{response: `{"id":1,"jsonrpc":"2.0","result":5}`, request: `{"id":42,"method":"getSlot"}`, replaced: `{"id":42,"jsonrpc":"2.0","result":5}`},
+		{response: `{"id":1,"result":5}`, request: `{"id":"abc","method":"getSlot"}`, replaced: `{"id":"abc","result":5}`},
+		{response: `{"id":1,"result":5}`, request: `{"method":"getSlot"}`, replaced: `{"id":1,"result":5}`},
+		{response: `{"id":1,"result":5}`, request: `not json`, replaced: `{"id":1,"result":5}`},
+		{response: `[{"id":1,"result":5}]`, request: `{"id":2}`, replaced: `[{"id":1,"result":5}]`},
+	}
+	for _, test := range tests {
+		if replaced := string(replaceId([]byte(test.response), []byte(test.request))); replaced != test.replaced {
+			t.Errorf("%s for %s: got %s, want %s", test.response, test.request, replaced, test.replaced)
+		}
+	}
+}
+
+func TestRawBody(t *testing.T) {
+	tests := map[string]string{
+		"{\n  \"result\": 5\n}": `{"result":5}`,
+		"":                      `""`,
+		"Bad Gateway\n":         `"Bad Gateway\n"`,
+	}
+	for body, raw := range tests {
+		if got := string(rawBody([]byte(body))); got != raw {
+			t.Errorf("%q: got %s, want %s", body, got, raw)
+		}
+	}
+}
+
+// Records a JSON-RPC answer, an http error with a body that isn't JSON and a failed
+// connection, and replays them in order
+func TestRecordReplay(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls > 1 {
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":1234}`))
+	}))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	path := filepath.Join(t.TempDir(), "recording.ndjson")
+	recorder, err := OpenRecorder(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientWithTransport(server.URL, recorder)
+	if slot, err := client.GetSlot(context.Background(), CommitmentConfirmed); err != nil || slot != 1234 {
+		t.Fatalf("got slot %d (%v) while recording", slot, err)
+	}
+	if _, err := client.GetSlot(context.Background(), CommitmentConfirmed); err == nil {
+		t.Fatal("got no error for the http error while recording")
+	}
+	if _, err := NewClientWithTransport(closed.URL, recorder).GetSlot(context.Background(), CommitmentConfirmed); err == nil {
+		t.Fatal("got no error from a closed server while recording")
+	}
+	recorder.Close()
+	server.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := ReadRecords(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1].Status != http.StatusBadGateway || string(records[1].Response) != `"Bad Gateway\n"` || records[2].Status != 0 || records[2].Error == "" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	replayer := NewReplayer(records)
+	client = NewClientWithTransport(server.URL, replayer)
+	if slot, err := client.GetSlot(context.Background(), CommitmentConfirmed); err != nil || slot != 1234 {
+		t.Errorf("got slot %d (%v) while replaying", slot, err)
+	}
+	if !replayer.Now().Equal(records[0].Time) {
+		t.Errorf("replayer time %v isn't the time of the first record %v", replayer.Now(), records[0].Time)
+	}
+	_, err = client.GetSlot(context.Background(), CommitmentConfirmed)
+	if err == nil || !strings.Contains(err.Error(), "http error") {
+		t.Errorf("got %v for the replayed http error", err)
+	}
+	if _, err := NewClientWithTransport(closed.URL, replayer).GetSlot(context.Background(), CommitmentConfirmed); err == nil {
+		t.Errorf("got no error for the replayed failed connection")
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("%d records left", replayer.Remaining())
+	}
+
+	// Every record is used once
+	if _, err := client.GetSlot(context.Background(), CommitmentConfirmed); err == nil {
+		t.Errorf("got a response with the recording used up")
+	}
+}
+
+// A replayed response keeps the body of the http error and gets the id of the request
+func TestReplayerResponse(t *testing.T) {
+	replayer := NewReplayer([]Record{
+		{Url: "http://node:8899", Request: []byte(`{"id":1,"method":"getSlot"}`), Status: http.StatusOK, Response: []byte(`{"id":1,"result":5}`)},
+		{Url: "http://node:8899", Request: []byte(`{"id":2,"method":"getSlot"}`), Status: http.StatusServiceUnavailable, Response: []byte(`"unavailable"`)},
+	})
+
+	for _, want := range []struct {
+		status int
+		body   string
+	}{
+		{status: http.StatusOK, body: `{"id":9,"result":5}`},
+		{status: http.StatusServiceUnavailable, body: "unavailable"},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, "http://node:8899", bytes.NewReader([]byte(`{"id":9,"method":"getSlot"}`)))
+		resp, err := replayer.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != want.status || string(body) != want.body {
+			t.Errorf("got %d %s, want %d %s", resp.StatusCode, body, want.status, want.body)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://node:8899", bytes.NewReader([]byte(`{"id":9,"method":"getSlot"}`)))
+	if _, err := replayer.RoundTrip(req); err != ErrNotRecorded {
+		t.Errorf("got %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestReadRecords(t *testing.T) {
+	records, err := ReadRecords(strings.NewReader("{\"url\":\"http://a\",\"req\":{},\"status\":200,\"d\":0}\n\n{\"url\":\"http://b\",\"req\":{},\"err\":\"refused\",\"d\":0}\n"))
+	if err != nil || len(records) != 2 || records[1].Error != "refused" {
+		t.Errorf("got %+v (%v)", records, err)
+	}
+	if _, err := ReadRecords(strings.NewReader("{\"url\":\"http://a\"}\n{")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got %v for a truncated recording", err)
+	}
+}
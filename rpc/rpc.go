@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -9,16 +10,27 @@ import (
 	"github.com/linuskendall/jsonrpc/v2"
 )
 
-var epoch_schedule EpochSchedule = EpochSchedule{FirstNormalEpoch: 0, FirstNormalSlot: 0, LeaderScheduleSlotOffset: 432000, SlotsPerEpoch: 432000, warmup: false}
-
 const MINIMUM_SLOTS_PER_EPOCH uint64 = 32
 
+// Returned by getHealth when the node is behind the cluster
+const ERROR_NODE_UNHEALTHY = -32005
+
+// Returned when a node hasn't reached the minContextSlot of a request
+const ERROR_MIN_CONTEXT_SLOT_NOT_REACHED = -32016
+
+// Returned by getBlock for slots without a block, a block that isn't available may still exist
+const (
+	ERROR_BLOCK_NOT_AVAILABLE    = -32004
+	ERROR_SLOT_SKIPPED           = -32007
+	ERROR_LONG_TERM_SLOT_SKIPPED = -32009
+)
+
 type Slot uint64
 type Epoch uint64
 type Block uint64
 
 type Identity struct {
-	Identity string `json:identity`
+	Identity string `json:"identity"`
 }
 
 type Version struct {
@@ -26,13 +38,48 @@ type Version struct {
 	CoreVersion string `json:"solana-core"`
 }
 
+// The node's own view of its health, from getHealth
+type Health struct {
+	Healthy bool `json:"healthy"`
+	// Set if an unhealthy node knows how far it is behind
+	NumSlotsBehind *uint64 `json:"numSlotsBehind,omitempty"`
+	Message        string  `json:"message,omitempty"`
+}
+
+// A block without its transactions and rewards
+type BlockInfo struct {
+	Blockhash         string `json:"blockhash"`
+	PreviousBlockhash string `json:"previousBlockhash"`
+	ParentSlot        Slot   `json:"parentSlot"`
+}
+
+// The slot at which a node answered a request
+type Context struct {
+	Slot Slot `json:"slot"`
+}
+
+// An account with base64 data, Data is [data, encoding]
+type AccountInfo struct {
+	Lamports   uint64   `json:"lamports"`
+	Owner      string   `json:"owner"`
+	Data       []string `json:"data"`
+	Executable bool     `json:"executable"`
+	RentEpoch  uint64   `json:"rentEpoch"`
+}
+
+// Value is nil if the account doesn't exist
+type AccountInfoResult struct {
+	Context Context      `json:"context"`
+	Value   *AccountInfo `json:"value"`
+}
+
 type EpochInfo struct {
-	AbsoluteSlot     Slot   `json:absoluteSlot`
-	BlockHeight      uint64 `json:blockHeight`
-	Epoch            Epoch  `json:epoch`
-	SlotIndex        uint64 `json:slotIndex`
-	SlotsInEpoch     uint64 `json:slotsInEpoch`
-	TransactionCount uint64 `json:transactionCount`
+	AbsoluteSlot     Slot   `json:"absoluteSlot"`
+	BlockHeight      uint64 `json:"blockHeight"`
+	Epoch            Epoch  `json:"epoch"`
+	SlotIndex        uint64 `json:"slotIndex"`
+	SlotsInEpoch     uint64 `json:"slotsInEpoch"`
+	TransactionCount uint64 `json:"transactionCount"`
 }
 
 type Client struct {
@@ -83,7 +130,15 @@ func NewError(url string, method string, e error) *RpcError {
 }
 
 func NewClient(url string) *Client {
+	return NewClientWithTransport(url, nil)
+}
+
+// Sends the requests through transport if it's not nil, e.g. a Recorder or Replayer
+func NewClientWithTransport(url string, transport http.RoundTripper) *Client {
 	rpcClient := jsonrpc.NewClient(url)
+	if transport != nil {
+		rpcClient = jsonrpc.NewClientWithOpts(url, &jsonrpc.RPCClientOpts{HTTPClient: &http.Client{Transport: transport}})
+	}
 	return &Client{
 		url:    url,
 		client: rpcClient,
@@ -106,12 +161,13 @@ func (c *Client) MinimumLedgerSlot(ctx context.Context) (out Slot, err error) {
 }
 
 func (c *Client) GetSlot(ctx context.Context, commitment CommitmentType) (out Slot, err error) {
-	var params []interface{}
+	// The commitment is passed in a config object, a single slice is sent as the params array
 	if commitment != "" {
-		params = append(params, string(commitment))
+		params := []interface{}{map[string]string{"commitment": string(commitment)}}
+		err = c.client.CallFor(ctx, &out, "getSlot", params)
+	} else {
+		err = c.client.CallFor(ctx, &out, "getSlot")
 	}
-
-	err = c.client.CallFor(ctx, &out, "getSlot")
 	if err != nil {
 		err = NewError(c.url, "getSlot", err)
 	}
@@ -120,12 +176,13 @@ func (c *Client) GetSlot(ctx context.Context, commitment CommitmentType) (out Sl
 }
 
 func (c *Client) GetEpochInfo(ctx context.Context, commitment CommitmentType) (out EpochInfo, err error) {
-	var params []interface{}
+	// The commitment is passed in a config object, a single slice is sent as the params array
 	if commitment != "" {
-		params = append(params, string(commitment))
+		params := []interface{}{map[string]string{"commitment": string(commitment)}}
+		err = c.client.CallFor(ctx, &out, "getEpochInfo", params)
+	} else {
+		err = c.client.CallFor(ctx, &out, "getEpochInfo")
 	}
-
-	err = c.client.CallFor(ctx, &out, "getEpochInfo")
 	if err != nil {
 		err = NewError(c.url, "getEpochInfo", err)
 	}
@@ -134,14 +191,11 @@ func (c *Client) GetEpochInfo(ctx context.Context, commitment CommitmentType) (o
 }
 
 func (c *Client) GetEpochSchedule(ctx context.Context) (out EpochSchedule, err error) {
-	if epoch_schedule.SlotsPerEpoch > 0 {
-		out = epoch_schedule
-	} else {
-		err = c.client.CallFor(ctx, &out, "getEpochSchedule")
-		if err != nil {
-			err = NewError(c.url, "getEpochSchedule", err)
-		}
+	err = c.client.CallFor(ctx, &out, "getEpochSchedule")
+	if err != nil {
+		err = NewError(c.url, "getEpochSchedule", err)
 	}
+
 	return
 }
 
@@ -198,3 +252,110 @@ func (c *Client) GetGenesisHash(ctx context.Context) (out string, err error) {
 
 	return
 }
+
+// Returns the health reported by the node, an unhealthy node isn't an error
+func (c *Client) GetHealth(ctx context.Context) (out Health, err error) {
+	var result string
+	err = c.client.CallFor(ctx, &result, "getHealth")
+
+	if rpcErr, ok := err.(*jsonrpc.RPCError); ok && rpcErr.Code == ERROR_NODE_UNHEALTHY {
+		out.Message = rpcErr.Message
+		// The data is {"numSlotsBehind": n}, or null if the node doesn't know
+		var data struct {
+			NumSlotsBehind *uint64 `json:"numSlotsBehind"`
+		}
+		if raw, err := json.Marshal(rpcErr.Data); err == nil && json.Unmarshal(raw, &data) == nil {
+			out.NumSlotsBehind = data.NumSlotsBehind
+		}
+		return out, nil
+	}
+	if err != nil {
+		err = NewError(c.url, "getHealth", err)
+		return
+	}
+
+	out.Healthy = result == "ok"
+	if !out.Healthy {
+		out.Message = result
+	}
+	return
+}
+
+// Returns the hashes of the block at slot, without transactions
+func (c *Client) GetBlock(ctx context.Context, slot Slot, commitment CommitmentType) (out BlockInfo, err error) {
+	config := map[string]interface{}{
+		"transactionDetails":             "none",
+		"rewards":                        false,
+		"maxSupportedTransactionVersion": 0,
+	}
+	if commitment != "" {
+		config["commitment"] = string(commitment)
+	}
+
+	err = c.client.CallFor(ctx, &out, "getBlock", uint64(slot), config)
+	if err != nil {
+		err = NewError(c.url, "getBlock", err)
+	}
+	return
+}
+
+// Whether the error says that there is no block at the slot, rather than that the call failed
+func IsSlotSkipped(err error) bool {
+	if rpcErr, ok := err.(*RpcError); ok {
+		err = rpcErr.Err
+	}
+	rpcErr, ok := err.(*jsonrpc.RPCError)
+	return ok && (rpcErr.Code == ERROR_SLOT_SKIPPED || rpcErr.Code == ERROR_LONG_TERM_SLOT_SKIPPED)
+}
+
+// Whether the error says that the node has no block at the slot, getBlockTime answers this for
+// skipped slots as well
+func IsBlockNotAvailable(err error) bool {
+	if rpcErr, ok := err.(*RpcError); ok {
+		err = rpcErr.Err
+	}
+	rpcErr, ok := err.(*jsonrpc.RPCError)
+	return ok && rpcErr.Code == ERROR_BLOCK_NOT_AVAILABLE
+}
+
+// Returns an account with base64 data. With minContextSlot the node only answers once it
+// has reached that slot, see IsMinContextSlotNotReached.
+func (c *Client) GetAccountInfo(ctx context.Context, account string, commitment CommitmentType, minContextSlot Slot) (out AccountInfoResult, err error) {
+	config := map[string]interface{}{
+		"encoding": "base64",
+	}
+	if commitment != "" {
+		config["commitment"] = string(commitment)
+	}
+	if minContextSlot > 0 {
+		config["minContextSlot"] = uint64(minContextSlot)
+	}
+
+	err = c.client.CallFor(ctx, &out, "getAccountInfo", account, config)
+	if err != nil {
+		err = NewError(c.url, "getAccountInfo", err)
+	}
+	return
+}
+
+func IsMinContextSlotNotReached(err error) bool {
+	if rpcErr, ok := err.(*RpcError); ok {
+		err = rpcErr.Err
+	}
+	rpcErr, ok := err.(*jsonrpc.RPCError)
+	return ok && rpcErr.Code == ERROR_MIN_CONTEXT_SLOT_NOT_REACHED
+}
+
+// Returns the estimated production time of the block at slot as a unix timestamp
+func (c *Client) GetBlockTime(ctx context.Context, slot Slot) (out int64, err error) {
+	var blockTime *int64
+	err = c.client.CallFor(ctx, &blockTime, "getBlockTime", uint64(slot))
+	if err == nil && blockTime == nil {
+		err = fmt.Errorf("no block time for slot %d", slot)
+	}
+	if err != nil {
+		err = NewError(c.url, "getBlockTime", err)
+		return
+	}
+	return *blockTime, nil
+}
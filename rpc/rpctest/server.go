@@ -0,0 +1,567 @@
+// Package rpctest provides an in-process fake Solana JSON-RPC server implementing the
+// methods used by rpc.Client, with scriptable state to test the health checks offline.
+//
+//	node := rpctest.NewServer()
+//	defer node.Close()
+//	node.SetSlotRate(0)
+//	node.SetSlot(1000)
+//	client := rpc.NewClient(node.URL)
+package rpctest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/linuskendall/solana-rpc-health-check/rpc"
+)
+
+// JSON-RPC error codes
+const (
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// Returned by solana for slots that were cleaned up or skipped
+	CodeBlockNotAvailable = -32004
+	CodeNodeUnhealthy     = -32005
+	CodeSlotSkipped       = -32007
+	// Returned for requests with a minContextSlot the node hasn't reached
+	CodeMinContextSlotNotReached = -32016
+)
+
+// The clock sysvar, its data is the slot it was read at
+const ClockSysvar = "SysvarC1ock11111111111111111111111111111111"
+
+// Mainnet slot rate, a slot every 400ms
+const DefaultSlotRate = 2.5
+
+// Number of slots the finalized slot is behind the current slot
+const RootDistance = 32
+
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type request struct {
+	JsonRpc string            `json:"jsonrpc"`
+	Id      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+type errorResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Error   *Error          `json:"error"`
+}
+
+// A fake node, the slot advances at the slot rate from the time it was last set
+type Server struct {
+	*httptest.Server
+
+	mu  sync.Mutex
+	now func() time.Time
+
+	slot        rpc.Slot
+	slotSetAt   time.Time
+	slotRate    float64
+	stalled     bool
+	ledgerSize  uint64
+	processed   uint64
+	retransmit  uint64
+	skipped     map[rpc.Slot]bool
+	schedule    rpc.EpochSchedule
+	genesisHash string
+	identity    string
+	version     rpc.Version
+	unhealthy   *Error
+	fork        string
+	forkSlot    rpc.Slot
+	accounts    map[string][]byte
+	// When slot 0 would have been produced at DefaultSlotRate, for block times
+	origin time.Time
+
+	errors     map[string]*Error
+	latencies  map[string]time.Duration
+	httpStatus int
+	calls      map[string]int
+}
+
+// Starts a server at slot 100000000 on mainnet's epoch schedule, which advances at DefaultSlotRate
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// Returns a server which isn't listening yet, see httptest.NewUnstartedServer
+func NewUnstartedServer() *Server {
+	s := &Server{
+		now:         time.Now,
+		slot:        100000000,
+		slotRate:    DefaultSlotRate,
+		ledgerSize:  500000,
+		processed:   2,
+		retransmit:  4,
+		skipped:     map[rpc.Slot]bool{},
+		schedule:    rpc.NewEpochSchedule(432000, 432000, false),
+		genesisHash: "5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d",
+		identity:    "7Np41oeYqPefeNQEHSv1UDhYrehxin3NStELsSKCT4K2",
+		version:     rpc.Version{FeatureSet: 1797267350, CoreVersion: "1.9.0"},
+		accounts:    map[string][]byte{},
+		errors:      map[string]*Error{},
+		latencies:   map[string]time.Duration{},
+		calls:       map[string]int{},
+	}
+	s.slotSetAt = s.now()
+	s.origin = s.blockTimeOrigin()
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Replaces the clock the slot advances with
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slot = s.currentSlot()
+	s.now = now
+	s.slotSetAt = now()
+	s.origin = s.blockTimeOrigin()
+}
+
+// Block times are those of a cluster at DefaultSlotRate that is at the current slot now, a node
+// that falls behind or stalls later has older block times
+func (s *Server) blockTimeOrigin() time.Time {
+	return s.now().Add(-time.Duration(float64(s.currentSlot()) / DefaultSlotRate * float64(time.Second)))
+}
+
+func (s *Server) blockTime(slot rpc.Slot) int64 {
+	return s.origin.Add(time.Duration(float64(slot) / DefaultSlotRate * float64(time.Second))).Unix()
+}
+
+func (s *Server) currentSlot() rpc.Slot {
+	if s.stalled || s.slotRate <= 0 {
+		return s.slot
+	}
+	return s.slot + rpc.Slot(s.now().Sub(s.slotSetAt).Seconds()*s.slotRate)
+}
+
+// The current (confirmed) slot
+func (s *Server) Slot() rpc.Slot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.currentSlot()
+}
+
+func (s *Server) SetSlot(slot rpc.Slot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slot = slot
+	s.slotSetAt = s.now()
+}
+
+// Moves the slot forward by n slots
+func (s *Server) Advance(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slot = s.currentSlot() + rpc.Slot(n)
+	s.slotSetAt = s.now()
+}
+
+// Slots per second, 0 only advances with SetSlot and Advance
+func (s *Server) SetSlotRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slot = s.currentSlot()
+	s.slotSetAt = s.now()
+	s.slotRate = rate
+}
+
+// Stops the slot from advancing until Resume
+func (s *Server) Stall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slot = s.currentSlot()
+	s.stalled = true
+}
+
+func (s *Server) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stalled = false
+	s.slotSetAt = s.now()
+}
+
+// Number of slots below the current slot that are stored, sets the minimum ledger slot
+func (s *Server) SetLedgerSize(slots uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ledgerSize = slots
+}
+
+// Slots the processed and max retransmit slots are ahead of the current slot
+func (s *Server) SetSlotLeads(processed uint64, retransmit uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed = processed
+	s.retransmit = retransmit
+}
+
+// Marks slots as having no block, they're left out of getConfirmedBlocks
+func (s *Server) SkipSlots(slots ...rpc.Slot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, slot := range slots {
+		s.skipped[slot] = true
+	}
+}
+
+// Marks all slots from first to last as having no block
+func (s *Server) SkipRange(first rpc.Slot, last rpc.Slot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for slot := first; slot <= last; slot++ {
+		s.skipped[slot] = true
+	}
+}
+
+// From the next slot on the node builds on a fork, its blocks get other hashes than those
+// of nodes on another fork. An empty name puts the node back on the main chain.
+func (s *Server) SetFork(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fork = name
+	s.forkSlot = s.currentSlot() + 1
+}
+
+// Sets the data of an account owned by the system program, nil removes the account
+func (s *Server) SetAccountData(address string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if data == nil {
+		delete(s.accounts, address)
+	} else {
+		s.accounts[address] = data
+	}
+}
+
+func (s *Server) SetEpochSchedule(schedule rpc.EpochSchedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = schedule
+}
+
+func (s *Server) SetGenesisHash(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.genesisHash = hash
+}
+
+func (s *Server) SetIdentity(identity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identity = identity
+}
+
+func (s *Server) SetVersion(version rpc.Version) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// Makes getHealth report the node as behind by slots, or as unhealthy without a number if slots is nil
+func (s *Server) SetUnhealthy(slots *uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unhealthy = &Error{Code: CodeNodeUnhealthy, Message: "Node is unhealthy"}
+	if slots != nil {
+		s.unhealthy.Message = fmt.Sprintf("Node is behind by %d slots", *slots)
+		s.unhealthy.Data = map[string]uint64{"numSlotsBehind": *slots}
+	}
+}
+
+// Makes getHealth answer ok again
+func (s *Server) SetHealthy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unhealthy = nil
+}
+
+// Makes a method, or every method with "*", return a JSON-RPC error. A nil error removes it.
+func (s *Server) SetError(method string, err *Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errors, method)
+	} else {
+		s.errors[method] = err
+	}
+}
+
+// Answers every request with this http status, 0 to answer normally again
+func (s *Server) SetHTTPStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.httpStatus = status
+}
+
+// Delays the responses to a method, or every method with "*"
+func (s *Server) SetLatency(method string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies[method] = latency
+}
+
+// Number of requests received for a method, or all methods with "*"
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if method == "*" {
+		n := 0
+		for _, c := range s.calls {
+			n += c
+		}
+		return n
+	}
+	return s.calls[method]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[req.Method]++
+	latency, ok := s.latencies[req.Method]
+	if !ok {
+		latency = s.latencies["*"]
+	}
+	status := s.httpStatus
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	result, err := s.call(req.Method, req.Params)
+	if err != nil {
+		json.NewEncoder(w).Encode(errorResponse{JsonRpc: "2.0", Id: req.Id, Error: err})
+	} else {
+		json.NewEncoder(w).Encode(response{JsonRpc: "2.0", Id: req.Id, Result: result})
+	}
+}
+
+func (s *Server) call(method string, params []json.RawMessage) (interface{}, *Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err, ok := s.errors[method]; ok {
+		return nil, err
+	}
+	if err, ok := s.errors["*"]; ok {
+		return nil, err
+	}
+
+	slot := s.currentSlot()
+	switch method {
+	case "getSlot":
+		var config struct {
+			Commitment string `json:"commitment"`
+		}
+		if len(params) > 0 {
+			// Either the commitment or a config object
+			if json.Unmarshal(params[0], &config.Commitment) != nil {
+				json.Unmarshal(params[0], &config)
+			}
+		}
+		return s.commitmentSlot(config.Commitment, slot), nil
+	case "getMaxRetransmitSlot":
+		return slot + rpc.Slot(s.retransmit), nil
+	case "minimumLedgerSlot":
+		return s.minimumSlot(slot), nil
+	case "getEpochInfo":
+		var config struct {
+			Commitment string `json:"commitment"`
+		}
+		if len(params) > 0 {
+			json.Unmarshal(params[0], &config)
+		}
+		slot = s.commitmentSlot(config.Commitment, slot)
+		epoch, index := s.schedule.GetEpochAndSlotIndex(slot)
+		return rpc.EpochInfo{
+			AbsoluteSlot:     slot,
+			BlockHeight:      uint64(slot) - uint64(len(s.skipped)),
+			Epoch:            epoch,
+			SlotIndex:        index,
+			SlotsInEpoch:     s.schedule.GetSlotsInEpoch(epoch),
+			TransactionCount: uint64(slot) * 1000,
+		}, nil
+	case "getEpochSchedule":
+		return s.schedule, nil
+	case "getConfirmedBlocks", "getBlocks":
+		var start, end uint64
+		if len(params) < 2 || json.Unmarshal(params[0], &start) != nil || json.Unmarshal(params[1], &end) != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params"}
+		}
+		return s.blocks(rpc.Slot(start), rpc.Slot(end), slot), nil
+	case "getBlock":
+		var block uint64
+		if len(params) < 1 || json.Unmarshal(params[0], &block) != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params"}
+		}
+		return s.block(rpc.Slot(block), slot)
+	case "getAccountInfo":
+		var address string
+		var config struct {
+			Commitment     string `json:"commitment"`
+			MinContextSlot uint64 `json:"minContextSlot"`
+		}
+		if len(params) < 1 || json.Unmarshal(params[0], &address) != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params"}
+		}
+		if len(params) > 1 {
+			json.Unmarshal(params[1], &config)
+		}
+		context := s.commitmentSlot(config.Commitment, slot)
+		if rpc.Slot(config.MinContextSlot) > context {
+			return nil, &Error{Code: CodeMinContextSlotNotReached, Message: "Minimum context slot has not been reached", Data: map[string]uint64{"contextSlot": uint64(context)}}
+		}
+		return rpc.AccountInfoResult{Context: rpc.Context{Slot: context}, Value: s.account(address, context)}, nil
+	case "getBlockTime":
+		var block uint64
+		if len(params) < 1 || json.Unmarshal(params[0], &block) != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params"}
+		}
+		if rpc.Slot(block) > slot || rpc.Slot(block) < s.minimumSlot(slot) || s.skipped[rpc.Slot(block)] {
+			return nil, &Error{Code: CodeBlockNotAvailable, Message: fmt.Sprintf("Block not available for slot %d", block)}
+		}
+		return s.blockTime(rpc.Slot(block)), nil
+	case "getVersion":
+		return s.version, nil
+	case "getIdentity":
+		return rpc.Identity{Identity: s.identity}, nil
+	case "getGenesisHash":
+		return s.genesisHash, nil
+	case "getHealth":
+		if s.unhealthy != nil {
+			return nil, s.unhealthy
+		}
+		return "ok", nil
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: "Method not found"}
+}
+
+func (s *Server) minimumSlot(slot rpc.Slot) rpc.Slot {
+	if uint64(slot) < s.ledgerSize {
+		return 0
+	}
+	return slot - rpc.Slot(s.ledgerSize)
+}
+
+// The stored blocks between start and end, without the skipped slots
+func (s *Server) blocks(start rpc.Slot, end rpc.Slot, slot rpc.Slot) []uint64 {
+	blocks := []uint64{}
+	if minimum := s.minimumSlot(slot); start < minimum {
+		start = minimum
+	}
+	if end > slot {
+		end = slot
+	}
+	for b := start; b <= end && start <= end; b++ {
+		if !s.skipped[b] {
+			blocks = append(blocks, uint64(b))
+		}
+	}
+	return blocks
+}
+
+// The hash of the block at a slot, which depends on the cluster and the fork the node is on
+func (s *Server) blockhash(slot rpc.Slot) string {
+	chain := s.genesisHash
+	if s.fork != "" && slot >= s.forkSlot {
+		chain += "/" + s.fork
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", chain, slot)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) block(block rpc.Slot, slot rpc.Slot) (interface{}, *Error) {
+	if block > slot || block < s.minimumSlot(slot) {
+		return nil, &Error{Code: CodeBlockNotAvailable, Message: fmt.Sprintf("Block not available for slot %d", block)}
+	}
+	if s.skipped[block] {
+		return nil, &Error{Code: CodeSlotSkipped, Message: fmt.Sprintf("Slot %d was skipped, or missing due to ledger jump to recent snapshot", block)}
+	}
+
+	parent := block
+	for parent > 0 {
+		parent--
+		if !s.skipped[parent] {
+			break
+		}
+	}
+	return rpc.BlockInfo{
+		Blockhash:         s.blockhash(block),
+		PreviousBlockhash: s.blockhash(parent),
+		ParentSlot:        parent,
+	}, nil
+}
+
+// The slot a request with the commitment is answered at, like a real node the default is finalized
+func (s *Server) commitmentSlot(commitment string, slot rpc.Slot) rpc.Slot {
+	switch commitment {
+	case string(rpc.CommitmentProcessed):
+		return slot + rpc.Slot(s.processed)
+	case string(rpc.CommitmentConfirmed):
+		return slot
+	}
+	if slot >= RootDistance {
+		return slot - RootDistance
+	}
+	return slot
+}
+
+func (s *Server) account(address string, slot rpc.Slot) *rpc.AccountInfo {
+	data, ok := s.accounts[address]
+	owner := "11111111111111111111111111111111"
+	if address == ClockSysvar && !ok {
+		data = make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, uint64(slot))
+		owner = "Sysvar1111111111111111111111111111111111111"
+	} else if !ok {
+		return nil
+	}
+	return &rpc.AccountInfo{
+		Lamports: 1000000000,
+		Owner:    owner,
+		Data:     []string{base64.StdEncoding.EncodeToString(data), "base64"},
+	}
+}
@@ -0,0 +1,227 @@
+package rpctest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/linuskendall/jsonrpc/v2"
+
+	"github.com/linuskendall/solana-rpc-health-check/rpc"
+	"github.com/linuskendall/solana-rpc-health-check/rpc/rpctest"
+)
+
+// Returns a stopped node at slot 1000 and a client for it
+func newNode(t *testing.T) (*rpctest.Server, *rpc.Client) {
+	node := rpctest.NewServer()
+	t.Cleanup(node.Close)
+	node.SetSlotRate(0)
+	node.SetSlot(1000)
+	return node, rpc.NewClient(node.URL)
+}
+
+// Returns the code of the json-rpc error wrapped by the client, 0 if there is none
+func errorCode(err error) int {
+	if rpcErr, ok := err.(*rpc.RpcError); ok {
+		err = rpcErr.Err
+	}
+	if rpcErr, ok := err.(*jsonrpc.RPCError); ok {
+		return rpcErr.Code
+	}
+	return 0
+}
+
+func TestSlot(t *testing.T) {
+	node, client := newNode(t)
+	node.SetSlotLeads(3, 5)
+	ctx := context.Background()
+
+	tests := []struct {
+		commitment rpc.CommitmentType
+		slot       rpc.Slot
+	}{
+		{commitment: rpc.CommitmentProcessed, slot: 1003},
+		{commitment: rpc.CommitmentConfirmed, slot: 1000},
+		{commitment: rpc.CommitmentFinalized, slot: 1000 - rpctest.RootDistance},
+		// Without a commitment a node answers at finalized
+		{commitment: "", slot: 1000 - rpctest.RootDistance},
+	}
+	for _, test := range tests {
+		slot, err := client.GetSlot(ctx, test.commitment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slot != test.slot {
+			t.Errorf("%s slot is %d, want %d", test.commitment, slot, test.slot)
+		}
+	}
+
+	if slot, err := client.GetMaxRetransmitSlot(ctx); err != nil || slot != 1005 {
+		t.Errorf("max retransmit slot is %d (%v), want 1005", slot, err)
+	}
+
+	node.Advance(10)
+	if slot, err := client.GetSlot(ctx, rpc.CommitmentConfirmed); err != nil || slot != 1010 {
+		t.Errorf("slot is %d (%v) after advancing, want 1010", slot, err)
+	}
+}
+
+func TestEpochInfo(t *testing.T) {
+	node, client := newNode(t)
+	node.SetEpochSchedule(rpc.NewEpochSchedule(432000, 432000, true))
+	node.SetSlot(956256)
+
+	info, err := client.GetEpochInfo(context.Background(), rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AbsoluteSlot != 956256 || info.Epoch != 15 || info.SlotIndex != 0 || info.SlotsInEpoch != 432000 {
+		t.Errorf("unexpected epoch info %+v", info)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	node, client := newNode(t)
+	ctx := context.Background()
+
+	block, err := client.GetBlock(ctx, 990, rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Blockhash == "" || block.ParentSlot != 989 {
+		t.Errorf("unexpected block %+v", block)
+	}
+
+	// Blocks produced after a node forked off have other hashes
+	other, otherClient := newNode(t)
+	other.SetFork("minority")
+	node.Advance(10)
+	other.Advance(10)
+	for _, slot := range []rpc.Slot{990, 1005} {
+		a, err := client.GetBlock(ctx, slot, rpc.CommitmentConfirmed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := otherClient.GetBlock(ctx, slot, rpc.CommitmentConfirmed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forked := slot > 1000; (a.Blockhash != b.Blockhash) != forked {
+			t.Errorf("block %d has hashes %s and %s, forked is %v", slot, a.Blockhash, b.Blockhash, forked)
+		}
+	}
+}
+
+func TestSkippedSlot(t *testing.T) {
+	node, client := newNode(t)
+	node.SkipSlots(989)
+	ctx := context.Background()
+
+	_, err := client.GetBlock(ctx, 989, rpc.CommitmentConfirmed)
+	if !rpc.IsSlotSkipped(err) {
+		t.Errorf("expected a skipped slot, got %v", err)
+	}
+	block, err := client.GetBlock(ctx, 990, rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.ParentSlot != 988 {
+		t.Errorf("parent of the block after the skipped slot is %d, want 988", block.ParentSlot)
+	}
+
+	// A block after the current slot isn't skipped, it's just not there yet
+	_, err = client.GetBlock(ctx, 1001, rpc.CommitmentConfirmed)
+	if err == nil || rpc.IsSlotSkipped(err) || errorCode(err) != rpctest.CodeBlockNotAvailable {
+		t.Errorf("expected block not available, got %v", err)
+	}
+
+	_, err = client.GetBlockTime(ctx, 989)
+	if !rpc.IsBlockNotAvailable(err) {
+		t.Errorf("expected no block time for a skipped slot, got %v", err)
+	}
+	if _, err := client.GetBlockTime(ctx, 990); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAccountInfo(t *testing.T) {
+	node, client := newNode(t)
+	node.SetAccountData("account", []byte("data"))
+	ctx := context.Background()
+
+	account, err := client.GetAccountInfo(ctx, "account", rpc.CommitmentFinalized, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Context.Slot != 1000-rpctest.RootDistance || account.Value == nil || account.Value.Data[0] != "ZGF0YQ==" {
+		t.Errorf("unexpected account %+v", account)
+	}
+
+	if account, err = client.GetAccountInfo(ctx, "missing", rpc.CommitmentFinalized, 0); err != nil || account.Value != nil {
+		t.Errorf("expected a missing account, got %+v (%v)", account, err)
+	}
+
+	_, err = client.GetAccountInfo(ctx, "account", rpc.CommitmentFinalized, 1000)
+	if !rpc.IsMinContextSlotNotReached(err) {
+		t.Errorf("expected min context slot not reached, got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	node, client := newNode(t)
+	ctx := context.Background()
+
+	node.SetError("getSlot", &rpctest.Error{Code: rpctest.CodeInternalError, Message: "Internal error"})
+	if _, err := client.GetSlot(ctx, rpc.CommitmentConfirmed); errorCode(err) != rpctest.CodeInternalError {
+		t.Errorf("expected an internal error, got %v", err)
+	}
+	if _, err := client.GetEpochInfo(ctx, rpc.CommitmentConfirmed); err != nil {
+		t.Errorf("error of getSlot returned for getEpochInfo: %v", err)
+	}
+	node.SetError("getSlot", nil)
+	if _, err := client.GetSlot(ctx, rpc.CommitmentConfirmed); err != nil {
+		t.Errorf("error after it was cleared: %v", err)
+	}
+
+	node.SetHTTPStatus(http.StatusServiceUnavailable)
+	_, err := client.GetSlot(ctx, rpc.CommitmentConfirmed)
+	if rpcErr, ok := err.(*rpc.RpcError); !ok {
+		t.Errorf("expected an rpc error, got %v", err)
+	} else if httpErr, ok := rpcErr.Err.(*jsonrpc.HTTPError); !ok || httpErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected http status 503, got %v", rpcErr.Err)
+	}
+	node.SetHTTPStatus(0)
+
+	if _, err := client.GetVersion(ctx); err != nil {
+		t.Error(err)
+	}
+	// Requests answered with an http error aren't counted
+	if calls := node.Calls("getSlot"); calls != 3 {
+		t.Errorf("got %d getSlot calls, want 3", calls)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	node, client := newNode(t)
+	ctx := context.Background()
+
+	health, err := client.GetHealth(ctx)
+	if err != nil || !health.Healthy {
+		t.Errorf("expected a healthy node, got %+v (%v)", health, err)
+	}
+
+	behind := uint64(42)
+	node.SetUnhealthy(&behind)
+	health, err = client.GetHealth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Healthy || health.NumSlotsBehind == nil || *health.NumSlotsBehind != 42 {
+		t.Errorf("expected a node 42 slots behind, got %+v", health)
+	}
+
+	node.SetUnhealthy(nil)
+	if health, err = client.GetHealth(ctx); err != nil || health.Healthy || health.NumSlotsBehind != nil {
+		t.Errorf("expected an unhealthy node without a number, got %+v (%v)", health, err)
+	}
+}